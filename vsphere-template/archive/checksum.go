@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Checksum is the sha256 sum of a local file, along with the size and
+// modification time the sum was computed for.
+type Checksum struct {
+	Sum     string
+	Size    int64
+	ModTime string
+}
+
+// LocalChecksum returns the checksum of the local file at path. If the size and
+// modification time of the file still match the cached checksum, the cached
+// checksum is returned without reading the file.
+func LocalChecksum(path string, cached Checksum) (Checksum, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	modTime := info.ModTime().UTC().Format(time.RFC3339Nano)
+	if cached.Sum != "" && cached.Size == info.Size() && cached.ModTime == modTime {
+		log.Printf("[DEBUG] Using cached checksum for %s", path)
+		return cached, nil
+	}
+
+	log.Printf("[DEBUG] Computing checksum for %s", path)
+	f, err := os.Open(path)
+	if err != nil {
+		return Checksum{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return Checksum{}, err
+	}
+
+	return Checksum{
+		Sum:     hex.EncodeToString(h.Sum(nil)),
+		Size:    info.Size(),
+		ModTime: modTime,
+	}, nil
+}
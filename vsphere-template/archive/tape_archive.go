@@ -13,6 +13,7 @@ import (
 )
 
 type TapeArchive struct {
+	ctx  context.Context
 	path string
 	Opener
 }
@@ -25,8 +26,11 @@ type Downloader interface {
 	Download(ctx context.Context, u *url.URL, param *soap.Download) (io.ReadCloser, int64, error)
 }
 
-func NewTapeArchive(path string, opener Opener) *TapeArchive {
+// NewTapeArchive returns an archive reading from the tar file at path. Reads
+// from the archive fail once ctx is done.
+func NewTapeArchive(ctx context.Context, path string, opener Opener) *TapeArchive {
 	return &TapeArchive{
+		ctx:    ctx,
 		path:   path,
 		Opener: opener,
 	}
@@ -42,12 +46,12 @@ func (e *TapeArchiveEntry) Close() error {
 }
 
 func (ta *TapeArchive) Open(name string) (io.ReadCloser, int64, error) {
-	f, _, err := ta.OpenFile(ta.path)
+	f, _, err := ta.OpenFile(ta.ctx, ta.path)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	r := tar.NewReader(f)
+	r := tar.NewReader(&contextReader{ctx: ta.ctx, r: f})
 
 	for {
 		h, err := r.Next()
@@ -73,9 +77,9 @@ func (ta *TapeArchive) Open(name string) (io.ReadCloser, int64, error) {
 	return nil, 0, os.ErrNotExist
 }
 
-func (o *Opener) OpenFile(path string) (io.ReadCloser, int64, error) {
-	if isRemotePath(path) {
-		return o.OpenRemote(path)
+func (o *Opener) OpenFile(ctx context.Context, path string) (io.ReadCloser, int64, error) {
+	if IsRemotePath(path) {
+		return o.OpenRemote(ctx, path)
 	}
 	return o.OpenLocal(path)
 }
@@ -94,7 +98,7 @@ func (o Opener) OpenLocal(path string) (io.ReadCloser, int64, error) {
 	return f, s.Size(), nil
 }
 
-func (o Opener) OpenRemote(link string) (io.ReadCloser, int64, error) {
+func (o Opener) OpenRemote(ctx context.Context, link string) (io.ReadCloser, int64, error) {
 	if o.Downloader == nil {
 		return nil, 0, errors.New("remote path not supported")
 	}
@@ -104,10 +108,25 @@ func (o Opener) OpenRemote(link string) (io.ReadCloser, int64, error) {
 		return nil, 0, err
 	}
 
-	return o.Download(context.Background(), u, &soap.DefaultDownload)
+	return o.Download(ctx, u, &soap.DefaultDownload)
 }
 
-func isRemotePath(path string) bool {
+// contextReader stops reading as soon as its context is done, so that long
+// reads of large archives can be interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// IsRemotePath reports whether path is a url rather than a local file.
+func IsRemotePath(path string) bool {
 	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
 		return true
 	}
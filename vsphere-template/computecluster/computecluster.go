@@ -0,0 +1,109 @@
+package computecluster
+
+import (
+	"context"
+	"fmt"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+	"strings"
+)
+
+func FromID(client *govmomi.Client, id string) (*object.ClusterComputeResource, error) {
+	log.Printf("[DEBUG] Locating compute cluster with ID %q", id)
+	finder := find.NewFinder(client.Client, false)
+
+	ref := types.ManagedObjectReference{
+		Type:  "ClusterComputeResource",
+		Value: id,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	obj, err := finder.ObjectReference(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] Compute cluster with ID %q found", obj.Reference().Value)
+	return obj.(*object.ClusterComputeResource), nil
+}
+
+// SelectHost returns the first host of the cluster that is connected, not in
+// maintenance mode, and has all of the datastores and networks mounted. If no
+// host qualifies, the error lists why each host was rejected.
+func SelectHost(
+	ctx context.Context,
+	client *govmomi.Client,
+	cluster *object.ClusterComputeResource,
+	datastores []types.ManagedObjectReference,
+	networks []types.ManagedObjectReference) (*object.HostSystem, error) {
+	hosts, err := cluster.Hosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("compute cluster %q does not contain any host", cluster.Reference().Value)
+	}
+
+	refs := make([]types.ManagedObjectReference, len(hosts))
+	for i, h := range hosts {
+		refs[i] = h.Reference()
+	}
+
+	var props []mo.HostSystem
+	pc := property.DefaultCollector(client.Client)
+	if err := pc.Retrieve(ctx, refs, []string{"name", "runtime", "datastore", "network"}, &props); err != nil {
+		return nil, err
+	}
+
+	var rejected []string
+	for _, p := range props {
+		if reason := unsuitable(p, datastores, networks); reason != "" {
+			log.Printf("[DEBUG] Skipping host %q: %s", p.Name, reason)
+			rejected = append(rejected, fmt.Sprintf("%s: %s", p.Name, reason))
+			continue
+		}
+
+		log.Printf("[DEBUG] Selected host %q in compute cluster %q", p.Name, cluster.Reference().Value)
+		return object.NewHostSystem(client.Client, p.Reference()), nil
+	}
+
+	return nil, fmt.Errorf(
+		"no host in compute cluster %q can hold the template:\n  %s",
+		cluster.Reference().Value, strings.Join(rejected, "\n  "))
+}
+
+// unsuitable returns why the host cannot be used, or an empty string if it can.
+func unsuitable(host mo.HostSystem, datastores []types.ManagedObjectReference, networks []types.ManagedObjectReference) string {
+	if host.Runtime.ConnectionState != types.HostSystemConnectionStateConnected {
+		return fmt.Sprintf("host is %s", host.Runtime.ConnectionState)
+	}
+	if host.Runtime.InMaintenanceMode {
+		return "host is in maintenance mode"
+	}
+	for _, ds := range datastores {
+		if !containsRef(host.Datastore, ds) {
+			return fmt.Sprintf("datastore %q is not mounted", ds.Value)
+		}
+	}
+	for _, n := range networks {
+		if !containsRef(host.Network, n) {
+			return fmt.Sprintf("network %q is not available", n.Value)
+		}
+	}
+	return ""
+}
+
+func containsRef(refs []types.ManagedObjectReference, ref types.ManagedObjectReference) bool {
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
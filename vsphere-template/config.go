@@ -24,6 +24,16 @@ import (
 	"golang.org/x/net/context"
 )
 
+// VSphereClient is the meta value passed to the resources of this provider.
+type VSphereClient struct {
+	// The VIM/govmomi client.
+	vimClient *govmomi.Client
+
+	// stopCtx is cancelled when terraform asks the provider to stop, for
+	// example when the user interrupts an apply.
+	stopCtx context.Context
+}
+
 // Config holds the provider configuration, and delivers a populated
 // VSphereClient based off the contained settings.
 type Config struct {
@@ -0,0 +1,94 @@
+package vsphere_template
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/archive"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/descriptor"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func dataSourceVspheretemplateOvaSpec() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceVspheretemplateOvaSpecRead,
+
+		Schema: map[string]*schema.Schema{
+			"ova_file_path": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "path to the ova file.",
+			},
+			"networks": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The networks the ovf declares, to be mapped with network_mapping.",
+			},
+			"deployment_options": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The IDs of the deployment options of the ovf.",
+			},
+			"properties": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "The default values of the ovf properties, by property key.",
+			},
+			"disks": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The IDs of the disks of the ovf.",
+			},
+			"virtual_systems": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The IDs of the virtual systems of a VirtualSystemCollection.",
+			},
+			"eulas": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The license agreements of the ovf, which have to be accepted with accept_eula.",
+			},
+		},
+	}
+}
+
+func dataSourceVspheretemplateOvaSpecRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(*VSphereClient)
+
+	ctx, cancel := context.WithTimeout(meta.stopCtx, defaultAPITimeout)
+	defer cancel()
+
+	ovaPath := d.Get("ova_file_path").(string)
+	desc, err := descriptor.Load(archive.NewTapeArchive(ctx, ovaPath, archive.Opener{Downloader: meta.vimClient}))
+	if err != nil {
+		return fmt.Errorf("error loading the ovf descriptor of %q: %s", ovaPath, err)
+	}
+
+	properties := map[string]string{}
+	for k, p := range desc.Properties() {
+		properties[k] = ""
+		if p.Default != nil {
+			properties[k] = *p.Default
+		}
+	}
+
+	var systems []string
+	for _, vs := range desc.VirtualSystems() {
+		systems = append(systems, vs.ID)
+	}
+
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(desc.Content))))
+	d.Set("networks", desc.Networks())
+	d.Set("deployment_options", desc.DeploymentOptions())
+	d.Set("properties", properties)
+	d.Set("disks", desc.DiskIDs())
+	d.Set("virtual_systems", systems)
+	d.Set("eulas", desc.Eulas())
+	return nil
+}
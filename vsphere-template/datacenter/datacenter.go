@@ -2,9 +2,12 @@ package datacenter
 
 import (
 	"context"
+	"fmt"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 	"log"
 )
@@ -33,3 +36,33 @@ func FromIDOrDefault(client *govmomi.Client, id string) (*object.Datacenter, err
 	log.Printf("[DEBUG] Datastore with ID %q found", dc.Reference().Value)
 	return dc.(*object.Datacenter), nil
 }
+
+// FromObject locates the datacenter the managed entity with the given
+// reference is in, by walking up its parents.
+func FromObject(client *govmomi.Client, ref types.ManagedObjectReference) (*object.Datacenter, error) {
+	log.Printf("[DEBUG] Locating datacenter of %s %q", ref.Type, ref.Value)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pc := property.DefaultCollector(client.Client)
+	current := ref
+	for current.Type != "Datacenter" {
+		var me mo.ManagedEntity
+		if err := pc.RetrieveOne(ctx, current, []string{"parent"}, &me); err != nil {
+			return nil, err
+		}
+		if me.Parent == nil {
+			return nil, fmt.Errorf("%s %q is not in a datacenter", ref.Type, ref.Value)
+		}
+		current = *me.Parent
+	}
+
+	finder := find.NewFinder(client.Client, false)
+	dc, err := finder.ObjectReference(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] %s %q is in datacenter %q", ref.Type, ref.Value, dc.(*object.Datacenter).InventoryPath)
+	return dc.(*object.Datacenter), nil
+}
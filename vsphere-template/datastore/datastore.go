@@ -5,6 +5,7 @@ import (
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 	"log"
 )
@@ -28,3 +29,19 @@ func FromID(client *govmomi.Client, id string) (*object.Datastore, error) {
 	log.Printf("[DEBUG] Datastore with ID %q found", ds.Reference().Value)
 	return ds.(*object.Datastore), nil
 }
+
+// Summary returns the summary of the datastore, with its name and its free
+// space in bytes. Unlike the name of the datastore object, the name in the
+// summary is also known for datastores that were not looked up by the finder.
+func Summary(ds *object.Datastore) (*types.DatastoreSummary, error) {
+	log.Printf("[DEBUG] Fetching summary of datastore %q", ds.Reference().Value)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var props mo.Datastore
+	if err := ds.Properties(ctx, ds.Reference(), []string{"summary"}, &props); err != nil {
+		return nil, err
+	}
+	return &props.Summary, nil
+}
@@ -0,0 +1,127 @@
+package descriptor
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/archive"
+	"github.com/vmware/govmomi/ovf"
+	"io/ioutil"
+	"strings"
+)
+
+// Descriptor is the ovf descriptor of an ova, both as raw content and parsed.
+type Descriptor struct {
+	Content  string
+	Envelope *ovf.Envelope
+
+	collection *collection
+}
+
+// Load reads and parses the ovf descriptor of the ova archive.
+func Load(a archive.Archive) (*Descriptor, error) {
+	reader, _, err := a.Open("*.ovf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ovf: %s", err)
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ovf: %s", err)
+	}
+
+	e, err := ovf.Unmarshal(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ovf: %s", err)
+	}
+
+	c, err := parseCollection(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ovf: %s", err)
+	}
+
+	return &Descriptor{
+		Content:    string(content),
+		Envelope:   e,
+		collection: c,
+	}, nil
+}
+
+// Networks returns the names of the networks the ovf declares.
+func (d *Descriptor) Networks() []string {
+	var names []string
+	if d.Envelope.Network != nil {
+		for _, n := range d.Envelope.Network.Networks {
+			names = append(names, n.Name)
+		}
+	}
+	return names
+}
+
+// DeploymentOptions returns the IDs of the deployment options the ovf
+// declares.
+func (d *Descriptor) DeploymentOptions() []string {
+	var ids []string
+	if d.Envelope.DeploymentOption != nil {
+		for _, c := range d.Envelope.DeploymentOption.Configuration {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// Properties returns the properties of all product sections of the ovf, by
+// their fully qualified key ([class.]key[.instance]).
+func (d *Descriptor) Properties() map[string]ovf.Property {
+	var sections []ovf.ProductSection
+	if d.Envelope.Product != nil {
+		sections = append(sections, *d.Envelope.Product)
+	}
+	if d.Envelope.VirtualSystem != nil {
+		sections = append(sections, d.Envelope.VirtualSystem.Product...)
+	}
+	if d.collection != nil {
+		sections = append(sections, d.collection.Product...)
+		for _, vs := range d.collection.VirtualSystems {
+			sections = append(sections, vs.Product...)
+		}
+	}
+
+	props := map[string]ovf.Property{}
+	for _, s := range sections {
+		for _, p := range s.Property {
+			key := p.Key
+			if s.Class != nil && *s.Class != "" {
+				key = *s.Class + "." + key
+			}
+			if s.Instance != nil && *s.Instance != "" {
+				key = key + "." + *s.Instance
+			}
+			props[key] = p
+		}
+	}
+	return props
+}
+
+// Eulas returns the license agreements of all EulaSections of the ovf.
+func (d *Descriptor) Eulas() []string {
+	var sections []ovf.EulaSection
+	if d.Envelope.Eula != nil {
+		sections = append(sections, *d.Envelope.Eula)
+	}
+	if d.Envelope.VirtualSystem != nil {
+		sections = append(sections, d.Envelope.VirtualSystem.Eula...)
+	}
+	if d.collection != nil {
+		sections = append(sections, d.collection.Eula...)
+		for _, vs := range d.collection.VirtualSystems {
+			sections = append(sections, vs.Eula...)
+		}
+	}
+
+	var licenses []string
+	for _, s := range sections {
+		licenses = append(licenses, strings.TrimSpace(s.License))
+	}
+	return licenses
+}
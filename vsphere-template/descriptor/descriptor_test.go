@@ -0,0 +1,125 @@
+package descriptor
+
+import "testing"
+
+// singleSystem is an ovf with a single virtual system, like the ones exported
+// by vSphere.
+const singleSystem = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf">
+  <References>
+    <File ovf:href="disk1.vmdk" ovf:id="file1" ovf:size="1073741824"/>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:capacity="16" ovf:capacityAllocationUnits="byte * 2^30" ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:populatedSize="2147483648"/>
+    <Disk ovf:capacity="512" ovf:capacityAllocationUnits="byte * 2^20" ovf:diskId="vmdisk2"/>
+  </DiskSection>
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+    <Network ovf:name="VM Network"/>
+  </NetworkSection>
+  <DeploymentOptionSection>
+    <Info>Deployment options</Info>
+    <Configuration ovf:id="small"><Label>Small</Label><Description>Small</Description></Configuration>
+    <Configuration ovf:id="large"><Label>Large</Label><Description>Large</Description></Configuration>
+  </DeploymentOptionSection>
+  <VirtualSystem ovf:id="appliance">
+    <Info>A virtual machine</Info>
+    <Name>appliance</Name>
+    <OperatingSystemSection ovf:id="101" vmw:osType="ubuntu64Guest">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <ProductSection ovf:class="vami" ovf:instance="appliance">
+      <Info>Information about the installed software</Info>
+      <Product>Appliance</Product>
+      <Property ovf:key="ip0" ovf:type="string" ovf:userConfigurable="true"/>
+    </ProductSection>
+    <ProductSection>
+      <Info>Information about the installed software</Info>
+      <Product>Appliance</Product>
+      <Property ovf:key="hostname" ovf:type="string" ovf:qualifiers="MinLen(1) MaxLen(8)" ovf:userConfigurable="true"/>
+      <Property ovf:key="size" ovf:type="string" ovf:qualifiers="ValueMap{&quot;small&quot;,&quot;large&quot;}" ovf:userConfigurable="true"/>
+      <Property ovf:key="debug" ovf:type="boolean" ovf:userConfigurable="true" ovf:value="False"/>
+      <Property ovf:key="ratio" ovf:type="real" ovf:userConfigurable="true"/>
+      <Property ovf:key="port" ovf:type="uint16" ovf:userConfigurable="true"/>
+      <Property ovf:key="offset" ovf:type="sint8" ovf:userConfigurable="true"/>
+      <Property ovf:key="count" ovf:type="uint64" ovf:userConfigurable="true"/>
+    </ProductSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemType>vmx-13</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:ElementName>2 virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>2</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:ElementName>SCSI Controller 0</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceSubType>LsiLogic</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:ElementName>Sound Card</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>ensoniq1371</rasd:ResourceSubType>
+        <rasd:ResourceType>35</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk 1</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:Parent>2</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>1</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk 2</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk2</rasd:HostResource>
+        <rasd:InstanceID>5</rasd:InstanceID>
+        <rasd:Parent>2</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>VM Network</rasd:Connection>
+        <rasd:ElementName>Network adapter 1</rasd:ElementName>
+        <rasd:InstanceID>6</rasd:InstanceID>
+        <rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+// parse returns the descriptor of the given ovf content.
+func parse(t *testing.T, content string) *Descriptor {
+	t.Helper()
+	d := &Descriptor{}
+	if err := d.reload(content); err != nil {
+		t.Fatalf("failed to parse ovf: %s", err)
+	}
+	return d
+}
+
+func TestProperties(t *testing.T) {
+	props := parse(t, singleSystem).Properties()
+
+	for _, k := range []string{"vami.ip0.appliance", "hostname", "size", "debug", "ratio", "port", "offset", "count"} {
+		if _, ok := props[k]; !ok {
+			t.Errorf("property %q not found in %v", k, props)
+		}
+	}
+	if len(props) != 8 {
+		t.Errorf("got %d properties, want 8", len(props))
+	}
+}
@@ -0,0 +1,143 @@
+package descriptor
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/vmware/govmomi/ovf"
+	"strconv"
+	"strings"
+)
+
+// diskResourceType is the CIM resource type of disk drive hardware items.
+const diskResourceType = 17
+
+// DiskIDs returns the IDs of the disks of the DiskSection of the ovf.
+func (d *Descriptor) DiskIDs() []string {
+	var ids []string
+	if d.Envelope.Disk != nil {
+		for _, disk := range d.Envelope.Disk.Disks {
+			ids = append(ids, disk.DiskID)
+		}
+	}
+	return ids
+}
+
+// SystemDisks returns the disk IDs of every virtual system of the ovf, in the
+// order of the disk items of its virtual hardware. That is the order in which
+// vSphere adds the disks to the import spec.
+func (d *Descriptor) SystemDisks() [][]string {
+	if d.Envelope.VirtualSystem != nil {
+		return [][]string{hardwareDisks(d.Envelope.VirtualSystem.VirtualHardware)}
+	}
+
+	var disks [][]string
+	for _, vs := range d.VirtualSystems() {
+		disks = append(disks, hardwareDisks(vs.VirtualHardware))
+	}
+	return disks
+}
+
+func hardwareDisks(sections []ovf.VirtualHardwareSection) []string {
+	if len(sections) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, item := range sections[0].Item {
+		if item.ResourceType == nil || *item.ResourceType != diskResourceType || len(item.HostResource) == 0 {
+			continue
+		}
+		// host resources of disks look like ovf:/disk/vmdisk1
+		ref := item.HostResource[0]
+		if i := strings.LastIndex(ref, "/disk/"); i >= 0 {
+			ids = append(ids, ref[i+len("/disk/"):])
+		}
+	}
+	return ids
+}
+
+// ValidateDisks checks that every given disk ID is declared by the ovf.
+func (d *Descriptor) ValidateDisks(ids []string) error {
+	declared := d.DiskIDs()
+
+	var result *multierror.Error
+	for _, id := range ids {
+		if !contains(declared, id) {
+			result = multierror.Append(result, fmt.Errorf(
+				"disk: ovf does not declare disk %q, declared disks are %s", id, quoteAll(declared)))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// DiskSize is the space a disk of the ovf needs.
+type DiskSize struct {
+	// Capacity is the size of the disk in bytes.
+	Capacity int64
+	// Populated is the number of bytes the disk actually uses. If the ovf
+	// does not declare it, the size of the disk file is used.
+	Populated int64
+}
+
+// DiskSizes returns the sizes of the disks of the DiskSection of the ovf, by
+// disk ID.
+func (d *Descriptor) DiskSizes() (map[string]DiskSize, error) {
+	sizes := map[string]DiskSize{}
+	if d.Envelope.Disk == nil {
+		return sizes, nil
+	}
+
+	files := map[string]int64{}
+	for _, f := range d.Envelope.References {
+		files[f.ID] = int64(f.Size)
+	}
+
+	for _, disk := range d.Envelope.Disk.Disks {
+		units := "byte"
+		if disk.CapacityAllocationUnits != nil {
+			units = *disk.CapacityAllocationUnits
+		}
+		multiplier, err := allocationUnits(units)
+		if err != nil {
+			return nil, fmt.Errorf("disk %q: %s", disk.DiskID, err)
+		}
+		capacity, err := strconv.ParseInt(strings.TrimSpace(disk.Capacity), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("disk %q: invalid capacity %q", disk.DiskID, disk.Capacity)
+		}
+
+		size := DiskSize{Capacity: capacity * multiplier}
+		if disk.PopulatedSize != nil {
+			size.Populated = int64(*disk.PopulatedSize)
+		} else if disk.FileRef != nil {
+			size.Populated = files[*disk.FileRef]
+		}
+		sizes[disk.DiskID] = size
+	}
+	return sizes, nil
+}
+
+// allocationUnits returns the number of bytes of programmatic units like
+// "byte * 2^30".
+func allocationUnits(units string) (int64, error) {
+	result := int64(1)
+	for _, factor := range strings.Split(units, "*") {
+		factor = strings.TrimSpace(factor)
+		switch {
+		case factor == "byte":
+		case strings.HasPrefix(factor, "2^"):
+			exp, err := strconv.Atoi(factor[2:])
+			if err != nil || exp < 0 || exp > 62 {
+				return 0, fmt.Errorf("invalid capacity allocation units %q", units)
+			}
+			result *= 1 << uint(exp)
+		default:
+			n, err := strconv.ParseInt(factor, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid capacity allocation units %q", units)
+			}
+			result *= n
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package descriptor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAllocationUnits(t *testing.T) {
+	cases := []struct {
+		units string
+		want  int64
+		err   bool
+	}{
+		{"byte", 1, false},
+		{"byte * 2^20", 1 << 20, false},
+		{"byte*2^30", 1 << 30, false},
+		{" byte * 2^10 * 1000 ", 1024000, false},
+		{"byte * 512", 512, false},
+		{"2^62", 1 << 62, false},
+		{"byte * 2^63", 0, true},
+		{"byte * 2^-1", 0, true},
+		{"byte * 10^6", 0, true},
+		{"megabyte", 0, true},
+		{"", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := allocationUnits(c.units)
+		if (err != nil) != c.err {
+			t.Errorf("allocationUnits(%q): got error %v, want error %t", c.units, err, c.err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("allocationUnits(%q) = %d, want %d", c.units, got, c.want)
+		}
+	}
+}
+
+func TestDiskSizes(t *testing.T) {
+	sizes, err := parse(t, singleSystem).DiskSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]DiskSize{
+		"vmdisk1": {Capacity: 16 << 30, Populated: 2 << 30},
+		"vmdisk2": {Capacity: 512 << 20},
+	}
+	if !reflect.DeepEqual(sizes, want) {
+		t.Errorf("got disk sizes %+v, want %+v", sizes, want)
+	}
+}
+
+func TestDiskSizesFromFile(t *testing.T) {
+	// without a populated size, the size of the referenced file is used.
+	content := strings.Replace(singleSystem, ` ovf:populatedSize="2147483648"`, "", 1)
+	sizes, err := parse(t, content).DiskSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sizes["vmdisk1"]; got.Capacity != 16<<30 || got.Populated != 1<<30 {
+		t.Errorf("got size %+v of vmdisk1", got)
+	}
+}
+
+func TestDiskSizesInvalidUnits(t *testing.T) {
+	content := strings.Replace(singleSystem, "byte * 2^20", "byte * 2^x", 1)
+	if _, err := parse(t, content).DiskSizes(); err == nil || !strings.Contains(err.Error(), `disk "vmdisk2"`) {
+		t.Errorf("expected an error for disk vmdisk2, got: %v", err)
+	}
+}
+
+func TestValidateDisks(t *testing.T) {
+	d := parse(t, singleSystem)
+	if err := d.ValidateDisks([]string{"vmdisk1", "vmdisk2"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := d.ValidateDisks([]string{"vmdisk3"}); err == nil {
+		t.Errorf("expected an error for an undeclared disk")
+	}
+}
@@ -0,0 +1,87 @@
+package descriptor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/vmware/govmomi/ovf"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Requirement is what a virtual system of the ovf needs from its host.
+type Requirement struct {
+	// System is the ID of the virtual system.
+	System string
+	// HardwareVersions are the virtual hardware versions, like vmx-13, any of
+	// which the virtual system can be created with.
+	HardwareVersions []string
+	// GuestID is the vSphere guest OS identifier, if the ovf declares one.
+	GuestID string
+}
+
+// Requirements returns the requirements of every virtual system of the ovf.
+func (d *Descriptor) Requirements() []Requirement {
+	if vs := d.Envelope.VirtualSystem; vs != nil {
+		return []Requirement{requirement(vs.ID, vs.VirtualHardware, vs.OperatingSystem)}
+	}
+
+	var reqs []Requirement
+	for _, vs := range d.VirtualSystems() {
+		reqs = append(reqs, requirement(vs.ID, vs.VirtualHardware, vs.OperatingSystem))
+	}
+	return reqs
+}
+
+func requirement(id string, hardware []ovf.VirtualHardwareSection, os []ovf.OperatingSystemSection) Requirement {
+	r := Requirement{System: id}
+	for _, h := range hardware {
+		if h.System != nil && h.System.VirtualSystemType != nil {
+			r.HardwareVersions = append(r.HardwareVersions, strings.FieldsFunc(*h.System.VirtualSystemType, func(c rune) bool {
+				return c == ' ' || c == ','
+			})...)
+		}
+	}
+	if len(os) > 0 && os[0].OSType != nil {
+		r.GuestID = *os[0].OSType
+	}
+	return r
+}
+
+var virtualSystemType = regexp.MustCompile(`(<(?:[\w-]+:)?VirtualSystemType>)[^<]*(</(?:[\w-]+:)?VirtualSystemType>)`)
+
+// SetHardwareVersion replaces the virtual hardware versions declared by the
+// virtual system with the given ID with the given version. Other virtual
+// systems of the ovf are left as they are.
+func (d *Descriptor) SetHardwareVersion(system string, version string) error {
+	dec := xml.NewDecoder(strings.NewReader(d.Content))
+
+	start, end := -1, -1
+	for end < 0 {
+		offset := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if start < 0 && t.Name.Local == "VirtualSystem" && attr(t, "id") == system {
+				start = offset
+			}
+		case xml.EndElement:
+			if start >= 0 && t.Name.Local == "VirtualSystem" {
+				end = int(dec.InputOffset())
+			}
+		}
+	}
+	if start < 0 || end < 0 {
+		return fmt.Errorf("ovf has no virtual system %q", system)
+	}
+
+	raw := virtualSystemType.ReplaceAllString(d.Content[start:end], "${1}"+version+"${2}")
+	return d.reload(d.Content[:start] + raw + d.Content[end:])
+}
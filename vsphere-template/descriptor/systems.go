@@ -0,0 +1,136 @@
+package descriptor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/vmware/govmomi/ovf"
+	"io"
+	"strings"
+)
+
+// VirtualSystem is a virtual system of a VirtualSystemCollection.
+type VirtualSystem struct {
+	ovf.Content
+
+	Product         []ovf.ProductSection         `xml:"ProductSection"`
+	Eula            []ovf.EulaSection            `xml:"EulaSection"`
+	VirtualHardware []ovf.VirtualHardwareSection `xml:"VirtualHardwareSection"`
+	OperatingSystem []ovf.OperatingSystemSection `xml:"OperatingSystemSection"`
+}
+
+// collection is the part of a VirtualSystemCollection the provider needs. The
+// ovf package only knows about single virtual systems.
+type collection struct {
+	ovf.Content
+
+	Product        []ovf.ProductSection `xml:"ProductSection"`
+	Eula           []ovf.EulaSection    `xml:"EulaSection"`
+	VirtualSystems []VirtualSystem      `xml:"VirtualSystem"`
+	Collections    []ovf.Content        `xml:"VirtualSystemCollection"`
+}
+
+type collectionEnvelope struct {
+	Collection *collection `xml:"VirtualSystemCollection"`
+}
+
+func parseCollection(content []byte) (*collection, error) {
+	var e collectionEnvelope
+	if err := xml.Unmarshal(content, &e); err != nil {
+		return nil, err
+	}
+	if e.Collection != nil && len(e.Collection.Collections) > 0 {
+		return nil, fmt.Errorf("nested VirtualSystemCollections are not supported")
+	}
+	return e.Collection, nil
+}
+
+// VirtualSystems returns the virtual systems of the VirtualSystemCollection of
+// the ovf, or nil if the ovf describes a single virtual system.
+func (d *Descriptor) VirtualSystems() []VirtualSystem {
+	if d.collection == nil {
+		return nil
+	}
+	return d.collection.VirtualSystems
+}
+
+// Split returns the content of the ovf with its VirtualSystemCollection
+// replaced by the virtual system with the given ID, so that it can be imported
+// on its own. Sections of the envelope, like references, disks and networks,
+// are kept as they are. The product sections of the collection are moved into
+// the virtual system, so that their properties can still be set; all other
+// sections of the collection are dropped.
+func (d *Descriptor) Split(id string) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(d.Content))
+
+	var depth int
+	collStart, collEnd, vsStart, vsEndTag, vsEnd := -1, -1, -1, -1, -1
+	productStart := -1
+	var products []string
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		inCollection := collStart >= 0 && collEnd < 0
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 && t.Name.Local == "VirtualSystemCollection" {
+				collStart = offset
+			}
+			if depth == 3 && inCollection && t.Name.Local == "VirtualSystem" && vsStart < 0 && attr(t, "id") == id {
+				vsStart = offset
+			}
+			if depth == 3 && inCollection && t.Name.Local == "ProductSection" {
+				productStart = offset
+			}
+		case xml.EndElement:
+			if depth == 3 && vsStart >= 0 && vsEnd < 0 && t.Name.Local == "VirtualSystem" {
+				vsEndTag, vsEnd = offset, int(dec.InputOffset())
+			}
+			if depth == 3 && productStart >= 0 && t.Name.Local == "ProductSection" {
+				products = append(products, d.Content[productStart:dec.InputOffset()])
+				productStart = -1
+			}
+			if depth == 2 && inCollection && t.Name.Local == "VirtualSystemCollection" {
+				collEnd = int(dec.InputOffset())
+			}
+			depth--
+		}
+	}
+
+	if collStart < 0 || collEnd < 0 {
+		return "", fmt.Errorf("ovf has no VirtualSystemCollection")
+	}
+	if vsStart < 0 || vsEnd < 0 {
+		return "", fmt.Errorf("ovf has no virtual system %q", id)
+	}
+
+	vs := d.Content[vsStart:vsEnd]
+	if len(products) > 0 {
+		sections := strings.Join(products, "")
+		if vsEndTag == vsEnd {
+			// a self-closing virtual system gets an end tag of its own.
+			name := strings.TrimPrefix(strings.Fields(vs)[0], "<")
+			vs = strings.TrimSuffix(vs, "/>") + ">" + sections + "</" + name + ">"
+		} else {
+			vs = d.Content[vsStart:vsEndTag] + sections + d.Content[vsEndTag:vsEnd]
+		}
+	}
+
+	return d.Content[:collStart] + vs + d.Content[collEnd:], nil
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package descriptor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// multipleSystems is an ovf with a VirtualSystemCollection of several virtual
+// systems. It uses prefixed ovf elements, and the last virtual system is an
+// empty, self-closing element.
+const multipleSystems = `<?xml version="1.0" encoding="UTF-8"?>
+<ovf:Envelope xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf">
+  <ovf:References>
+    <ovf:File ovf:href="web.vmdk" ovf:id="file1"/>
+    <ovf:File ovf:href="db.vmdk" ovf:id="file2"/>
+  </ovf:References>
+  <ovf:DiskSection>
+    <ovf:Info>Virtual disk information</ovf:Info>
+    <ovf:Disk ovf:capacity="10" ovf:capacityAllocationUnits="byte * 2^30" ovf:diskId="web-disk" ovf:fileRef="file1"/>
+    <ovf:Disk ovf:capacity="20" ovf:capacityAllocationUnits="byte * 2^30" ovf:diskId="db-disk" ovf:fileRef="file2"/>
+  </ovf:DiskSection>
+  <ovf:VirtualSystemCollection ovf:id="stack">
+    <ovf:Info>A collection of virtual machines</ovf:Info>
+    <ovf:Name>stack</ovf:Name>
+    <ovf:ProductSection ovf:class="stack">
+      <ovf:Info>Information about the stack</ovf:Info>
+      <ovf:Property ovf:key="domain" ovf:type="string"/>
+    </ovf:ProductSection>
+    <ovf:VirtualSystem ovf:id="web">
+      <ovf:Info>The web server</ovf:Info>
+      <ovf:Name>web</ovf:Name>
+      <ovf:OperatingSystemSection ovf:id="101" vmw:osType="ubuntu64Guest">
+        <ovf:Info>The guest operating system</ovf:Info>
+      </ovf:OperatingSystemSection>
+      <ovf:VirtualHardwareSection>
+        <ovf:Info>Virtual hardware requirements</ovf:Info>
+        <ovf:System>
+          <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+          <vssd:InstanceID>0</vssd:InstanceID>
+          <vssd:VirtualSystemType>vmx-11 vmx-13</vssd:VirtualSystemType>
+        </ovf:System>
+        <ovf:Item>
+          <rasd:ElementName>Hard Disk 1</rasd:ElementName>
+          <rasd:HostResource>ovf:/disk/web-disk</rasd:HostResource>
+          <rasd:InstanceID>1</rasd:InstanceID>
+          <rasd:ResourceType>17</rasd:ResourceType>
+        </ovf:Item>
+      </ovf:VirtualHardwareSection>
+    </ovf:VirtualSystem>
+    <ovf:VirtualSystem ovf:id="db">
+      <ovf:Info>The database</ovf:Info>
+      <ovf:Name>db</ovf:Name>
+      <ovf:VirtualHardwareSection>
+        <ovf:Info>Virtual hardware requirements</ovf:Info>
+        <ovf:System>
+          <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+          <vssd:InstanceID>0</vssd:InstanceID>
+          <vssd:VirtualSystemType>vmx-14</vssd:VirtualSystemType>
+        </ovf:System>
+        <ovf:Item>
+          <rasd:ElementName>Hard Disk 1</rasd:ElementName>
+          <rasd:HostResource>ovf:/disk/db-disk</rasd:HostResource>
+          <rasd:InstanceID>1</rasd:InstanceID>
+          <rasd:ResourceType>17</rasd:ResourceType>
+        </ovf:Item>
+      </ovf:VirtualHardwareSection>
+    </ovf:VirtualSystem>
+    <ovf:VirtualSystem ovf:id="empty"/>
+  </ovf:VirtualSystemCollection>
+</ovf:Envelope>
+`
+
+func TestVirtualSystems(t *testing.T) {
+	if systems := parse(t, singleSystem).VirtualSystems(); systems != nil {
+		t.Errorf("expected no virtual systems of a single virtual system ovf, got %d", len(systems))
+	}
+
+	d := parse(t, multipleSystems)
+	var ids []string
+	for _, vs := range d.VirtualSystems() {
+		ids = append(ids, vs.ID)
+	}
+	if want := []string{"web", "db", "empty"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got virtual systems %v, want %v", ids, want)
+	}
+
+	if got, want := d.SystemDisks(), [][]string{{"web-disk"}, {"db-disk"}, nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got system disks %v, want %v", got, want)
+	}
+
+	want := []Requirement{
+		{System: "web", HardwareVersions: []string{"vmx-11", "vmx-13"}, GuestID: "ubuntu64Guest"},
+		{System: "db", HardwareVersions: []string{"vmx-14"}},
+		{System: "empty"},
+	}
+	if got := d.Requirements(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got requirements %+v, want %+v", got, want)
+	}
+
+	if _, ok := d.Properties()["stack.domain"]; !ok {
+		t.Errorf("property stack.domain of the collection not found")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	d := parse(t, multipleSystems)
+
+	cases := []struct {
+		id      string
+		disks   []string
+		version string
+		absent  []string
+	}{
+		{"web", []string{"web-disk"}, "vmx-11 vmx-13", []string{`ovf:id="db"`, `ovf:id="empty"`, "VirtualSystemCollection", "A collection of virtual machines"}},
+		{"db", []string{"db-disk"}, "vmx-14", []string{`ovf:id="web"`, `ovf:id="empty"`, "VirtualSystemCollection"}},
+		{"empty", nil, "", []string{`ovf:id="web"`, `ovf:id="db"`, "VirtualSystemCollection"}},
+	}
+
+	for _, c := range cases {
+		content, err := d.Split(c.id)
+		if err != nil {
+			t.Errorf("Split(%q): %s", c.id, err)
+			continue
+		}
+		for _, s := range c.absent {
+			if strings.Contains(content, s) {
+				t.Errorf("Split(%q): %s was not removed", c.id, s)
+			}
+		}
+
+		split := parse(t, content)
+		if vs := split.Envelope.VirtualSystem; vs == nil || vs.ID != c.id {
+			t.Errorf("Split(%q): got virtual system %+v", c.id, vs)
+			continue
+		}
+		if split.VirtualSystems() != nil {
+			t.Errorf("Split(%q): result still has a collection", c.id)
+		}
+		// the sections of the envelope are kept.
+		if got := split.DiskIDs(); !reflect.DeepEqual(got, []string{"web-disk", "db-disk"}) {
+			t.Errorf("Split(%q): got disks %v in the DiskSection", c.id, got)
+		}
+		if got := split.SystemDisks(); !reflect.DeepEqual(got, [][]string{c.disks}) {
+			t.Errorf("Split(%q): got system disks %v, want %v", c.id, got, c.disks)
+		}
+		reqs := split.Requirements()
+		if got := strings.Join(reqs[0].HardwareVersions, " "); got != c.version {
+			t.Errorf("Split(%q): got hardware versions %q, want %q", c.id, got, c.version)
+		}
+		// the product sections of the collection move into the virtual system.
+		if products := split.Envelope.VirtualSystem.Product; len(products) == 0 || products[len(products)-1].Class == nil || *products[len(products)-1].Class != "stack" {
+			t.Errorf("Split(%q): got product sections %+v, want the one of the collection", c.id, products)
+		}
+		if _, ok := split.Properties()["stack.domain"]; !ok {
+			t.Errorf("Split(%q): property stack.domain was dropped", c.id)
+		}
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	if _, err := parse(t, multipleSystems).Split("mail"); err == nil || !strings.Contains(err.Error(), `no virtual system "mail"`) {
+		t.Errorf("expected an error for an unknown virtual system, got: %v", err)
+	}
+	if _, err := parse(t, singleSystem).Split("appliance"); err == nil || !strings.Contains(err.Error(), "no VirtualSystemCollection") {
+		t.Errorf("expected an error for an ovf without collection, got: %v", err)
+	}
+}
+
+func TestNestedCollections(t *testing.T) {
+	nested := strings.Replace(multipleSystems, `<ovf:VirtualSystem ovf:id="empty"/>`,
+		`<ovf:VirtualSystemCollection ovf:id="inner"><ovf:Info>Nested</ovf:Info></ovf:VirtualSystemCollection>`, 1)
+
+	d := &Descriptor{}
+	if err := d.reload(nested); err == nil || !strings.Contains(err.Error(), "nested VirtualSystemCollections") {
+		t.Errorf("expected an error for nested collections, got: %v", err)
+	}
+}
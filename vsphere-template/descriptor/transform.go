@@ -0,0 +1,186 @@
+package descriptor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/vmware/govmomi/ovf"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ItemRule changes the virtual hardware items of the ovf that match all of its
+// non-empty match fields.
+type ItemRule struct {
+	// ResourceType matches the CIM resource type of the item, if not 0.
+	ResourceType int
+	// ResourceSubType matches the resource sub type of the item, if set.
+	ResourceSubType string
+	// ElementName matches the element name of the item, if set.
+	ElementName string
+
+	// Remove removes matching items.
+	Remove bool
+	// SetResourceSubType replaces the resource sub type of matching items.
+	SetResourceSubType string
+}
+
+func (r ItemRule) matches(item ovf.ResourceAllocationSettingData) bool {
+	if r.ResourceType != 0 && (item.ResourceType == nil || int(*item.ResourceType) != r.ResourceType) {
+		return false
+	}
+	if r.ResourceSubType != "" && (item.ResourceSubType == nil || *item.ResourceSubType != r.ResourceSubType) {
+		return false
+	}
+	if r.ElementName != "" && item.ElementName != r.ElementName {
+		return false
+	}
+	return true
+}
+
+// FixupRules are the built-in rules for ovfs exported by VirtualBox or
+// Workstation: they drop devices vSphere rejects and rename controller types
+// vSphere does not know.
+var FixupRules = []ItemRule{
+	// sound cards
+	{ResourceType: 35, Remove: true},
+	// usb controllers
+	{ResourceType: 23, Remove: true},
+	{ResourceType: 20, ResourceSubType: "AHCI", SetResourceSubType: "vmware.sata.ahci"},
+	{ResourceType: 6, ResourceSubType: "LsiLogic", SetResourceSubType: "lsilogic"},
+	{ResourceType: 6, ResourceSubType: "LsiLogicSas", SetResourceSubType: "lsilogicsas"},
+	{ResourceType: 6, ResourceSubType: "BusLogic", SetResourceSubType: "buslogic"},
+}
+
+// fixupHardwareVersion is declared for virtual systems whose virtual system
+// type is not a vSphere hardware version, like virtualbox-2.2.
+const fixupHardwareVersion = "vmx-10"
+
+// ApplyFixups applies the FixupRules, and replaces virtual system types that
+// are not vSphere hardware versions.
+func (d *Descriptor) ApplyFixups() error {
+	content := virtualSystemType.ReplaceAllStringFunc(d.Content, func(element string) string {
+		m := virtualSystemType.FindStringSubmatch(element)
+		inner := element[len(m[1]) : len(element)-len(m[2])]
+		if vmxVersion.MatchString(inner) {
+			return element
+		}
+		return m[1] + fixupHardwareVersion + m[2]
+	})
+	if err := d.reload(content); err != nil {
+		return err
+	}
+	return d.Transform(FixupRules)
+}
+
+var vmxVersion = regexp.MustCompile(`\bvmx-\d+\b`)
+
+var (
+	resourceSubType      = regexp.MustCompile(`(<(?:[\w-]+:)?ResourceSubType>)[^<]*(</(?:[\w-]+:)?ResourceSubType>)`)
+	emptyResourceSubType = regexp.MustCompile(`<((?:[\w-]+:)?)ResourceSubType\s*/>`)
+	resourceType         = regexp.MustCompile(`<((?:[\w-]+:)?)ResourceType>`)
+)
+
+// setResourceSubType sets the resource sub type of a raw hardware item. Items
+// with an empty sub type element get a filled one, and items without one get
+// one before their resource type, the order of the CIM schema.
+func setResourceSubType(raw string, value string) string {
+	if resourceSubType.MatchString(raw) {
+		return resourceSubType.ReplaceAllString(raw, "${1}"+value+"${2}")
+	}
+	if m := emptyResourceSubType.FindStringSubmatchIndex(raw); m != nil {
+		prefix := raw[m[2]:m[3]]
+		return raw[:m[0]] + "<" + prefix + "ResourceSubType>" + value + "</" + prefix + "ResourceSubType>" + raw[m[1]:]
+	}
+	if m := resourceType.FindStringSubmatchIndex(raw); m != nil {
+		prefix := raw[m[2]:m[3]]
+		return raw[:m[0]] + "<" + prefix + "ResourceSubType>" + value + "</" + prefix + "ResourceSubType>" + raw[m[0]:]
+	}
+	return raw
+}
+
+// Transform applies the rules to the virtual hardware items of every virtual
+// system of the ovf. The first matching rule of an item wins.
+func (d *Descriptor) Transform(rules []ItemRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(d.Content))
+
+	var out bytes.Buffer
+	last := 0
+	inHardware := 0
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "VirtualHardwareSection" {
+				inHardware++
+				continue
+			}
+			if inHardware == 0 || !isHardwareItem(t.Name.Local) {
+				continue
+			}
+
+			var item ovf.ResourceAllocationSettingData
+			if err := dec.DecodeElement(&item, &t); err != nil {
+				return fmt.Errorf("failed to parse hardware item: %s", err)
+			}
+			end := int(dec.InputOffset())
+
+			for _, r := range rules {
+				if !r.matches(item) {
+					continue
+				}
+				out.WriteString(d.Content[last:offset])
+				if !r.Remove {
+					raw := d.Content[offset:end]
+					if r.SetResourceSubType != "" {
+						raw = setResourceSubType(raw, r.SetResourceSubType)
+					}
+					out.WriteString(raw)
+				}
+				last = end
+				break
+			}
+		case xml.EndElement:
+			if t.Name.Local == "VirtualHardwareSection" {
+				inHardware--
+			}
+		}
+	}
+	out.WriteString(d.Content[last:])
+
+	return d.reload(out.String())
+}
+
+func isHardwareItem(name string) bool {
+	return name == "Item" || name == "EthernetPortItem" || name == "StorageItem"
+}
+
+// reload replaces the content of the descriptor and parses it again.
+func (d *Descriptor) reload(content string) error {
+	e, err := ovf.Unmarshal(bytes.NewReader([]byte(content)))
+	if err != nil {
+		return fmt.Errorf("failed to parse ovf: %s", err)
+	}
+	c, err := parseCollection([]byte(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse ovf: %s", err)
+	}
+
+	d.Content = content
+	d.Envelope = e
+	d.collection = c
+	return nil
+}
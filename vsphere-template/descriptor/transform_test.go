@@ -0,0 +1,230 @@
+package descriptor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// itemNames returns the element names of the hardware items of the single
+// virtual system of the descriptor.
+func itemNames(t *testing.T, d *Descriptor) []string {
+	t.Helper()
+	var names []string
+	for _, item := range d.Envelope.VirtualSystem.VirtualHardware[0].Item {
+		names = append(names, item.ElementName)
+	}
+	return names
+}
+
+// itemSubType returns the resource sub type of the hardware item with the
+// given element name.
+func itemSubType(t *testing.T, d *Descriptor, name string) string {
+	t.Helper()
+	for _, item := range d.Envelope.VirtualSystem.VirtualHardware[0].Item {
+		if item.ElementName == name {
+			if item.ResourceSubType == nil {
+				return ""
+			}
+			return *item.ResourceSubType
+		}
+	}
+	t.Fatalf("item %q not found", name)
+	return ""
+}
+
+func TestTransform(t *testing.T) {
+	cases := []struct {
+		name     string
+		rules    []ItemRule
+		items    []string
+		subTypes map[string]string
+	}{
+		{
+			name:  "no rules",
+			items: []string{"2 virtual CPU(s)", "SCSI Controller 0", "Sound Card", "Hard Disk 1", "Hard Disk 2", "Network adapter 1"},
+		},
+		{
+			name:  "remove by resource type",
+			rules: []ItemRule{{ResourceType: 35, Remove: true}},
+			items: []string{"2 virtual CPU(s)", "SCSI Controller 0", "Hard Disk 1", "Hard Disk 2", "Network adapter 1"},
+		},
+		{
+			name:  "remove by element name",
+			rules: []ItemRule{{ElementName: "Hard Disk 2", Remove: true}},
+			items: []string{"2 virtual CPU(s)", "SCSI Controller 0", "Sound Card", "Hard Disk 1", "Network adapter 1"},
+		},
+		{
+			name:     "replace sub type",
+			rules:    []ItemRule{{ResourceType: 10, ResourceSubType: "VmxNet3", SetResourceSubType: "E1000"}},
+			subTypes: map[string]string{"Network adapter 1": "E1000", "SCSI Controller 0": "LsiLogic"},
+		},
+		{
+			name:     "sub type does not match",
+			rules:    []ItemRule{{ResourceType: 10, ResourceSubType: "E1000", Remove: true}},
+			subTypes: map[string]string{"Network adapter 1": "VmxNet3"},
+		},
+		{
+			name: "first matching rule wins",
+			rules: []ItemRule{
+				{ResourceType: 17, ElementName: "Hard Disk 1", SetResourceSubType: "kept"},
+				{ResourceType: 17, Remove: true},
+			},
+			items: []string{"2 virtual CPU(s)", "SCSI Controller 0", "Sound Card", "Hard Disk 1", "Network adapter 1"},
+		},
+		{
+			name:  "fixups",
+			rules: FixupRules,
+			items: []string{"2 virtual CPU(s)", "SCSI Controller 0", "Hard Disk 1", "Hard Disk 2", "Network adapter 1"},
+			subTypes: map[string]string{
+				"SCSI Controller 0": "lsilogic",
+				"Network adapter 1": "VmxNet3",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		d := parse(t, singleSystem)
+		if err := d.Transform(c.rules); err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if c.items != nil {
+			if got := itemNames(t, d); !reflect.DeepEqual(got, c.items) {
+				t.Errorf("%s: got items %q, want %q", c.name, got, c.items)
+			}
+		}
+		for name, want := range c.subTypes {
+			if got := itemSubType(t, d, name); got != want {
+				t.Errorf("%s: got sub type %q of %q, want %q", c.name, got, name, want)
+			}
+		}
+		// the rest of the descriptor is kept as it is.
+		if !strings.Contains(d.Content, `<DiskSection>`) || !strings.HasSuffix(d.Content, "</Envelope>\n") {
+			t.Errorf("%s: descriptor was not kept outside of the hardware items", c.name)
+		}
+	}
+}
+
+func TestTransformSetsEmptyAndMissingSubTypes(t *testing.T) {
+	// the controller has an empty, self-closing sub type, the network adapter
+	// none at all.
+	content := strings.Replace(singleSystem, "<rasd:ResourceSubType>LsiLogic</rasd:ResourceSubType>", "<rasd:ResourceSubType/>", 1)
+	content = strings.Replace(content, "<rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType>\n        ", "", 1)
+
+	d := parse(t, content)
+	err := d.Transform([]ItemRule{
+		{ResourceType: 6, SetResourceSubType: "lsilogic"},
+		{ResourceType: 10, SetResourceSubType: "VmxNet3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := itemSubType(t, d, "SCSI Controller 0"); got != "lsilogic" {
+		t.Errorf("got sub type %q of the controller, want lsilogic", got)
+	}
+	if got := itemSubType(t, d, "Network adapter 1"); got != "VmxNet3" {
+		t.Errorf("got sub type %q of the network adapter, want VmxNet3", got)
+	}
+	if !strings.Contains(d.Content, "<rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType><rasd:ResourceType>10</rasd:ResourceType>") {
+		t.Errorf("missing sub type was not added before the resource type:\n%s", d.Content)
+	}
+}
+
+func TestTransformItemKinds(t *testing.T) {
+	// items of other namespaces, a self-closing item, and items of every
+	// virtual system of a collection.
+	content := strings.Replace(multipleSystems, `<ovf:VirtualSystem ovf:id="empty"/>`, `<ovf:VirtualSystem ovf:id="devices">
+      <ovf:Info>Other items</ovf:Info>
+      <ovf:VirtualHardwareSection xmlns:epasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_EthernetPortAllocationSettingData" xmlns:sasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_StorageAllocationSettingData">
+        <ovf:Info>Virtual hardware requirements</ovf:Info>
+        <ovf:EthernetPortItem>
+          <epasd:ElementName>Ethernet 1</epasd:ElementName>
+          <epasd:InstanceID>1</epasd:InstanceID>
+          <epasd:ResourceSubType>PCNet32</epasd:ResourceSubType>
+          <epasd:ResourceType>10</epasd:ResourceType>
+        </ovf:EthernetPortItem>
+        <ovf:StorageItem>
+          <sasd:ElementName>Disk 1</sasd:ElementName>
+          <sasd:InstanceID>2</sasd:InstanceID>
+          <sasd:ResourceType>17</sasd:ResourceType>
+        </ovf:StorageItem>
+        <ovf:Item/>
+      </ovf:VirtualHardwareSection>
+    </ovf:VirtualSystem>`, 1)
+
+	d := parse(t, content)
+	err := d.Transform([]ItemRule{
+		{ResourceType: 17, Remove: true},
+		{ResourceType: 10, SetResourceSubType: "VmxNet3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.SystemDisks(); !reflect.DeepEqual(got, [][]string{nil, nil, nil}) {
+		t.Errorf("disk items were not removed from every virtual system: %v", got)
+	}
+	for _, s := range []string{"<ovf:StorageItem>", "Hard Disk 1"} {
+		if strings.Contains(d.Content, s) {
+			t.Errorf("%s was not removed", s)
+		}
+	}
+	for _, s := range []string{"<epasd:ResourceSubType>VmxNet3</epasd:ResourceSubType>", "<ovf:Item/>", "</ovf:VirtualSystemCollection>"} {
+		if !strings.Contains(d.Content, s) {
+			t.Errorf("%s is missing:\n%s", s, d.Content)
+		}
+	}
+}
+
+func TestApplyFixups(t *testing.T) {
+	cases := []struct {
+		systemType string
+		want       string
+	}{
+		{"vmx-13", "vmx-13"},
+		{"vmx-11 vmx-13", "vmx-11 vmx-13"},
+		{"virtualbox-2.2", "vmx-10"},
+		{"vmwarevmx-7", "vmx-10"},
+	}
+
+	for _, c := range cases {
+		content := strings.Replace(singleSystem, "<vssd:VirtualSystemType>vmx-13<", "<vssd:VirtualSystemType>"+c.systemType+"<", 1)
+		d := parse(t, content)
+		if err := d.ApplyFixups(); err != nil {
+			t.Errorf("%s: %s", c.systemType, err)
+			continue
+		}
+		if got := strings.Join(d.Requirements()[0].HardwareVersions, " "); got != c.want {
+			t.Errorf("%s: got hardware versions %q, want %q", c.systemType, got, c.want)
+		}
+		if got := itemNames(t, d); contains(got, "Sound Card") {
+			t.Errorf("%s: the sound card was not removed", c.systemType)
+		}
+	}
+}
+
+func TestSetHardwareVersion(t *testing.T) {
+	d := parse(t, multipleSystems)
+	if err := d.SetHardwareVersion("db", "vmx-10"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"web": {"vmx-11", "vmx-13"}, "db": {"vmx-10"}}
+	for _, r := range d.Requirements()[:2] {
+		if !reflect.DeepEqual(r.HardwareVersions, want[r.System]) {
+			t.Errorf("got hardware versions %v of %q, want %v", r.HardwareVersions, r.System, want[r.System])
+		}
+	}
+
+	d = parse(t, singleSystem)
+	if err := d.SetHardwareVersion("appliance", "vmx-10"); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Requirements()[0].HardwareVersions; !reflect.DeepEqual(got, []string{"vmx-10"}) {
+		t.Errorf("got hardware versions %v of %q, want vmx-10", got, "appliance")
+	}
+
+	if err := d.SetHardwareVersion("missing", "vmx-10"); err == nil {
+		t.Errorf("expected an error for a missing virtual system")
+	}
+}
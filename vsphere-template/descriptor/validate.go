@@ -0,0 +1,155 @@
+package descriptor
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/vmware/govmomi/ovf"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateNetworks checks that every given network name is declared by the
+// ovf.
+func (d *Descriptor) ValidateNetworks(names []string) error {
+	declared := d.Networks()
+
+	var result *multierror.Error
+	for _, name := range names {
+		if !contains(declared, name) {
+			result = multierror.Append(result, fmt.Errorf(
+				"network_mapping: ovf does not declare network %q, declared networks are %s", name, quoteAll(declared)))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// ValidateDeploymentOption checks that the deployment option is declared by
+// the ovf.
+func (d *Descriptor) ValidateDeploymentOption(option string) error {
+	declared := d.DeploymentOptions()
+	if !contains(declared, option) {
+		return fmt.Errorf("deployment_option: ovf does not declare deployment option %q, declared options are %s", option, quoteAll(declared))
+	}
+	return nil
+}
+
+// ValidateProperties checks that every property is declared by the ovf, and
+// that its value matches the type and qualifiers of the property.
+func (d *Descriptor) ValidateProperties(values map[string]string) error {
+	declared := d.Properties()
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var result *multierror.Error
+	for _, k := range keys {
+		p, ok := declared[k]
+		if !ok {
+			result = multierror.Append(result, fmt.Errorf("properties: ovf does not declare property %q", k))
+			continue
+		}
+		if err := validatePropertyValue(p, values[k]); err != nil {
+			result = multierror.Append(result, fmt.Errorf("properties: invalid value for %q: %s", k, err))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+var intRanges = map[string][2]int64{
+	"uint8":  {0, 1<<8 - 1},
+	"uint16": {0, 1<<16 - 1},
+	"uint32": {0, 1<<32 - 1},
+	"sint8":  {-1 << 7, 1<<7 - 1},
+	"sint16": {-1 << 15, 1<<15 - 1},
+	"sint32": {-1 << 31, 1<<31 - 1},
+}
+
+func validatePropertyValue(p ovf.Property, value string) error {
+	switch p.Type {
+	case "boolean":
+		if value != "True" && value != "False" && value != "true" && value != "false" {
+			return fmt.Errorf("%q is not a boolean, use True or False", value)
+		}
+	case "real":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%q is not a real number", value)
+		}
+	case "uint64":
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an uint64", value)
+		}
+	case "sint64":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not a sint64", value)
+		}
+	default:
+		if r, ok := intRanges[p.Type]; ok {
+			i, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || i < r[0] || i > r[1] {
+				return fmt.Errorf("%q is not a %s", value, p.Type)
+			}
+		}
+	}
+
+	if p.Qualifiers != nil {
+		return validateQualifiers(*p.Qualifiers, value)
+	}
+	return nil
+}
+
+var (
+	lenQualifier      = regexp.MustCompile(`(MinLen|MaxLen)\((\d+)\)`)
+	valueMapQualifier = regexp.MustCompile(`ValueMap\{([^}]*)\}`)
+)
+
+// validateQualifiers checks the value against the MinLen, MaxLen and ValueMap
+// qualifiers of a property. Other qualifiers are left to vSphere.
+func validateQualifiers(qualifiers string, value string) error {
+	for _, m := range lenQualifier.FindAllStringSubmatch(qualifiers, -1) {
+		n, _ := strconv.Atoi(m[2])
+		l := utf8.RuneCountInString(value)
+		if m[1] == "MinLen" && l < n {
+			return fmt.Errorf("value must be at least %d characters long", n)
+		}
+		if m[1] == "MaxLen" && l > n {
+			return fmt.Errorf("value must be at most %d characters long", n)
+		}
+	}
+
+	if m := valueMapQualifier.FindStringSubmatch(qualifiers); m != nil {
+		var allowed []string
+		for _, v := range strings.Split(m[1], ",") {
+			allowed = append(allowed, strings.Trim(strings.TrimSpace(v), `"`))
+		}
+		if !contains(allowed, value) {
+			return fmt.Errorf("%q is not one of %s", value, quoteAll(allowed))
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteAll(list []string) string {
+	if len(list) == 0 {
+		return "(none)"
+	}
+	quoted := make([]string, len(list))
+	for i, v := range list {
+		quoted[i] = strconv.Quote(v)
+	}
+	return strings.Join(quoted, ", ")
+}
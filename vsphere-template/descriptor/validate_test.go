@@ -0,0 +1,76 @@
+package descriptor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateProperties(t *testing.T) {
+	d := parse(t, singleSystem)
+
+	cases := []struct {
+		name   string
+		values map[string]string
+		err    string
+	}{
+		{"empty", map[string]string{}, ""},
+		{"valid", map[string]string{
+			"vami.ip0.appliance": "10.0.0.1",
+			"hostname":           "vm-1",
+			"size":               "large",
+			"debug":              "True",
+			"ratio":              "0.5",
+			"port":               "65535",
+			"offset":             "-128",
+			"count":              "18446744073709551615",
+		}, ""},
+		{"lowercase boolean", map[string]string{"debug": "false"}, ""},
+		{"undeclared", map[string]string{"ip0": "10.0.0.1"}, `does not declare property "ip0"`},
+		{"boolean", map[string]string{"debug": "yes"}, `"yes" is not a boolean`},
+		{"real", map[string]string{"ratio": "half"}, `"half" is not a real number`},
+		{"uint16 overflow", map[string]string{"port": "65536"}, `"65536" is not a uint16`},
+		{"uint16 negative", map[string]string{"port": "-1"}, `"-1" is not a uint16`},
+		{"sint8 underflow", map[string]string{"offset": "-129"}, `"-129" is not a sint8`},
+		{"uint64", map[string]string{"count": "-1"}, `"-1" is not an uint64`},
+		{"MinLen", map[string]string{"hostname": ""}, "at least 1 characters"},
+		{"MaxLen", map[string]string{"hostname": "hostname-1"}, "at most 8 characters"},
+		{"ValueMap", map[string]string{"size": "medium"}, `"medium" is not one of "small", "large"`},
+		{"all errors", map[string]string{"debug": "yes", "port": "x"}, `"x" is not a uint16`},
+	}
+
+	for _, c := range cases {
+		err := d.ValidateProperties(c.values)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		case c.err != "" && err == nil:
+			t.Errorf("%s: expected an error containing %q", c.name, c.err)
+		case c.err != "" && !strings.Contains(err.Error(), c.err):
+			t.Errorf("%s: expected an error containing %q, got: %s", c.name, c.err, err)
+		}
+	}
+}
+
+func TestValidateNetworks(t *testing.T) {
+	d := parse(t, singleSystem)
+
+	if err := d.ValidateNetworks([]string{"VM Network"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	err := d.ValidateNetworks([]string{"VM Network", "Storage"})
+	if err == nil || !strings.Contains(err.Error(), `does not declare network "Storage", declared networks are "VM Network"`) {
+		t.Errorf("expected an error for network Storage, got: %v", err)
+	}
+}
+
+func TestValidateDeploymentOption(t *testing.T) {
+	d := parse(t, singleSystem)
+
+	if err := d.ValidateDeploymentOption("large"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	err := d.ValidateDeploymentOption("medium")
+	if err == nil || !strings.Contains(err.Error(), `declared options are "small", "large"`) {
+		t.Errorf("expected an error for option medium, got: %v", err)
+	}
+}
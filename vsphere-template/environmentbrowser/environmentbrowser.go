@@ -0,0 +1,93 @@
+package environmentbrowser
+
+import (
+	"context"
+	"fmt"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+)
+
+// FromResourcePool returns the environment browser of the compute resource or
+// cluster the resource pool belongs to.
+func FromResourcePool(client *govmomi.Client, pool types.ManagedObjectReference) (types.ManagedObjectReference, error) {
+	log.Printf("[DEBUG] Locating environment browser for resource pool %q", pool.Value)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pc := property.DefaultCollector(client.Client)
+
+	var rp mo.ResourcePool
+	if err := pc.RetrieveOne(ctx, pool, []string{"owner"}, &rp); err != nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("error fetching owner of resource pool %q: %s", pool.Value, err)
+	}
+
+	var cr mo.ComputeResource
+	if err := pc.RetrieveOne(ctx, rp.Owner, []string{"environmentBrowser"}, &cr); err != nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("error fetching environment browser of %q: %s", rp.Owner.Value, err)
+	}
+	if cr.EnvironmentBrowser == nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("compute resource %q has no environment browser", rp.Owner.Value)
+	}
+	return *cr.EnvironmentBrowser, nil
+}
+
+// HardwareVersions returns the virtual hardware versions, like vmx-13, new
+// virtual machines can be created with. If host is not nil, only the versions
+// supported by the host are returned.
+func HardwareVersions(client *govmomi.Client, browser types.ManagedObjectReference, host *types.ManagedObjectReference) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := types.QueryConfigOptionDescriptor{This: browser}
+	res, err := methods.QueryConfigOptionDescriptor(ctx, client.Client, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, d := range res.Returnval {
+		if d.CreateSupported == nil || !*d.CreateSupported {
+			continue
+		}
+		if host != nil && len(d.Host) > 0 && !containsRef(d.Host, *host) {
+			continue
+		}
+		versions = append(versions, d.Key)
+	}
+	return versions, nil
+}
+
+// GuestIDs returns the guest OS identifiers supported by the hardware version.
+func GuestIDs(client *govmomi.Client, browser types.ManagedObjectReference, version string, host *types.ManagedObjectReference) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := types.QueryConfigOption{This: browser, Key: version, Host: host}
+	res, err := methods.QueryConfigOption(ctx, client.Client, &req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Returnval == nil {
+		return nil, fmt.Errorf("no config options returned for hardware version %q", version)
+	}
+
+	var ids []string
+	for _, g := range res.Returnval.GuestOSDescriptor {
+		ids = append(ids, g.Id)
+	}
+	return ids, nil
+}
+
+func containsRef(refs []types.ManagedObjectReference, ref types.ManagedObjectReference) bool {
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
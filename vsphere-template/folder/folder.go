@@ -2,10 +2,14 @@ package folder
 
 import (
 	"context"
+	"fmt"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
 	"log"
+	"path"
+	"strings"
 )
 
 func FromName(client *govmomi.Client, name string) (*object.Folder, error) {
@@ -22,3 +26,139 @@ func FromName(client *govmomi.Client, name string) (*object.Folder, error) {
 	log.Printf("[DEBUG] Folder with Name %s found", fd.Name())
 	return fd, nil
 }
+
+func FromID(client *govmomi.Client, id string) (*object.Folder, error) {
+	log.Printf("[DEBUG] Locating folder with ID %s", id)
+	finder := find.NewFinder(client.Client, false)
+
+	ref := types.ManagedObjectReference{
+		Type:  "Folder",
+		Value: id,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fd, err := finder.ObjectReference(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] Folder with ID %s found", fd.Reference().Value)
+	return fd.(*object.Folder), nil
+}
+
+// IsID reports whether the given folder is a managed object ID rather than a
+// path.
+func IsID(folder string) bool {
+	return strings.HasPrefix(folder, "group-")
+}
+
+// VMFolder returns the VM folder of the datacenter, with its inventory path
+// set.
+func VMFolder(ctx context.Context, dc *object.Datacenter) (*object.Folder, error) {
+	folders, err := dc.Folders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vmFolder := folders.VmFolder
+	if dc.InventoryPath != "" {
+		vmFolder.InventoryPath = path.Join(dc.InventoryPath, "vm")
+	}
+	return vmFolder, nil
+}
+
+// FromPathOrID locates the folder to put a virtual machine in. folder can be
+// a managed object ID, an absolute inventory path, or a path relative to the
+// VM folder of the datacenter. An empty folder is the VM folder itself. If
+// create is set, missing folders below the VM folder are created.
+func FromPathOrID(ctx context.Context, client *govmomi.Client, dc *object.Datacenter, folder string, create bool) (*object.Folder, error) {
+	if IsID(folder) {
+		return FromID(client, folder)
+	}
+
+	vmFolder, err := VMFolder(ctx, dc)
+	if err != nil {
+		return nil, fmt.Errorf("error locating VM folder of datacenter %q: %s", dc.InventoryPath, err)
+	}
+
+	rel, ok := Relative(vmFolder.InventoryPath, folder)
+	if !ok {
+		// absolute paths outside of the VM folder can only be looked up.
+		return FromName(client, folder)
+	}
+
+	log.Printf("[DEBUG] Locating folder %q below %q", rel, vmFolder.InventoryPath)
+	finder := find.NewFinder(client.Client, false)
+
+	current := vmFolder
+	for _, name := range strings.Split(rel, "/") {
+		if name == "" {
+			continue
+		}
+
+		p := path.Join(current.InventoryPath, name)
+		next, err := finder.Folder(ctx, p)
+		if _, notFound := err.(*find.NotFoundError); notFound && create {
+			log.Printf("[DEBUG] Creating folder %q", p)
+			next, err = current.CreateFolder(ctx, name)
+			if err == nil {
+				next.InventoryPath = p
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error locating folder %q: %s", p, err)
+		}
+		current = next
+	}
+
+	log.Printf("[DEBUG] Folder %q found", current.InventoryPath)
+	return current, nil
+}
+
+// Relative returns folder relative to the VM folder at vmFolderPath. The
+// second return value is false if folder is an absolute path outside of the
+// VM folder.
+func Relative(vmFolderPath string, folder string) (string, bool) {
+	if !strings.HasPrefix(folder, "/") {
+		return strings.Trim(folder, "/"), true
+	}
+
+	folder = path.Clean(folder)
+	if folder == vmFolderPath {
+		return "", true
+	}
+	if strings.HasPrefix(folder, vmFolderPath+"/") {
+		return strings.TrimPrefix(folder, vmFolderPath+"/"), true
+	}
+	return "", false
+}
+
+// Normalize returns the folder at parentPath, with managed object ID parent,
+// in the same form as the configured folder: as managed object ID, absolute
+// path, or path relative to the VM folder at vmFolderPath.
+func Normalize(configured string, vmFolderPath string, parent types.ManagedObjectReference, parentPath string) string {
+	if IsID(configured) {
+		return parent.Value
+	}
+	if strings.HasPrefix(configured, "/") {
+		return parentPath
+	}
+	if rel, ok := Relative(vmFolderPath, parentPath); ok {
+		return rel
+	}
+	return parentPath
+}
+
+// NormalizePath removes redundant and trailing slashes from a folder path, so
+// that equivalent paths are stored the same way.
+func NormalizePath(v interface{}) string {
+	folder := v.(string)
+	if IsID(folder) {
+		return folder
+	}
+	if strings.HasPrefix(folder, "/") {
+		return path.Clean(folder)
+	}
+	return strings.Trim(path.Clean("/"+folder), "/")
+}
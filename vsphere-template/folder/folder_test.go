@@ -0,0 +1,79 @@
+package folder
+
+import (
+	"github.com/vmware/govmomi/vim25/types"
+	"testing"
+)
+
+const vmFolderPath = "/dc1/vm"
+
+func TestRelative(t *testing.T) {
+	cases := []struct {
+		folder string
+		want   string
+		ok     bool
+	}{
+		{"", "", true},
+		{"templates", "templates", true},
+		{"templates/linux/", "templates/linux", true},
+		{"/templates/", "", false},
+		{"/dc1/vm", "", true},
+		{"/dc1/vm/", "", true},
+		{"/dc1/vm/templates", "templates", true},
+		{"/dc1/vm//templates/linux/", "templates/linux", true},
+		{"/dc1/vm/../vm/templates", "templates", true},
+		{"/dc1/vmware", "", false},
+		{"/dc2/vm/templates", "", false},
+	}
+
+	for _, c := range cases {
+		got, ok := Relative(vmFolderPath, c.folder)
+		if got != c.want || ok != c.ok {
+			t.Errorf("Relative(%q, %q) = %q, %t, want %q, %t", vmFolderPath, c.folder, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	parent := types.ManagedObjectReference{Type: "Folder", Value: "group-v42"}
+
+	cases := []struct {
+		configured string
+		parentPath string
+		want       string
+	}{
+		{"group-v42", "/dc1/vm/templates", "group-v42"},
+		{"/dc1/vm/templates/", "/dc1/vm/templates", "/dc1/vm/templates"},
+		{"templates", "/dc1/vm/templates", "templates"},
+		{"", "/dc1/vm", ""},
+		// the template was moved out of the VM folder of the datacenter.
+		{"templates", "/dc2/vm/templates", "/dc2/vm/templates"},
+	}
+
+	for _, c := range cases {
+		got := Normalize(c.configured, vmFolderPath, parent, c.parentPath)
+		if got != c.want {
+			t.Errorf("Normalize(%q, %q) = %q, want %q", c.configured, c.parentPath, got, c.want)
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	cases := []struct {
+		folder string
+		want   string
+	}{
+		{"", ""},
+		{"group-v42", "group-v42"},
+		{"templates/", "templates"},
+		{"/templates//linux/", "/templates/linux"},
+		{"templates//linux", "templates/linux"},
+		{"./templates", "templates"},
+	}
+
+	for _, c := range cases {
+		if got := NormalizePath(c.folder); got != c.want {
+			t.Errorf("NormalizePath(%q) = %q, want %q", c.folder, got, c.want)
+		}
+	}
+}
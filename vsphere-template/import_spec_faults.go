@@ -0,0 +1,70 @@
+package vsphere_template
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+	"reflect"
+)
+
+// importSpecError returns an error listing all faults vSphere reported for an
+// import spec, each with its fault type and, for common faults, a hint on how
+// to fix it. It returns nil if there are no faults.
+func importSpecError(faults []types.LocalizedMethodFault) error {
+	var result *multierror.Error
+	for _, f := range faults {
+		result = multierror.Append(result, fmt.Errorf("%s", describeFault(f)))
+	}
+	return result.ErrorOrNil()
+}
+
+// importSpecWarnings logs the warnings vSphere reported for an import spec,
+// and returns them, described the same way as errors.
+func importSpecWarnings(faults []types.LocalizedMethodFault) []string {
+	var warnings []string
+	for _, f := range faults {
+		w := describeFault(f)
+		log.Printf("[WARN] %s\n", w)
+		warnings = append(warnings, w)
+	}
+	return warnings
+}
+
+func describeFault(f types.LocalizedMethodFault) string {
+	msg := fmt.Sprintf("%s: %s", faultType(f.Fault), f.LocalizedMessage)
+	if hint := faultHint(f.Fault); hint != "" {
+		msg += " (" + hint + ")"
+	}
+	return msg
+}
+
+// faultType returns the vSphere name of the fault, e.g. DuplicateName.
+func faultType(fault types.BaseMethodFault) string {
+	if fault == nil {
+		return "Fault"
+	}
+	t := reflect.TypeOf(fault)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func faultHint(fault types.BaseMethodFault) string {
+	switch f := fault.(type) {
+	case *types.DuplicateName:
+		return fmt.Sprintf("an object named %q already exists in the folder, choose another name or folder", f.Name)
+	case *types.InvalidName:
+		return fmt.Sprintf("%q is not a valid name, names are limited to 80 characters and must not contain '/', '\\' or '%%'", f.Name)
+	case *types.FileAlreadyExists:
+		return "the datastore already holds files of a virtual machine with this name, " +
+			"possibly left over from a failed import; remove them or choose another name or datastore"
+	case *types.HostNotConnected:
+		return "the host is disconnected from vCenter, reconnect it or set host_system_id or cluster_id to another host"
+	case types.BaseInsufficientResourcesFault:
+		return "the resource pool or host lacks the CPU, memory or storage the ova requires, " +
+			"free up resources, choose another resource_pool_id or cluster_id, or pick a smaller deployment_option"
+	}
+	return ""
+}
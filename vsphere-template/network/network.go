@@ -0,0 +1,105 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+	"strings"
+)
+
+// networkTypes are the managed object types a virtual machine can be
+// connected to.
+var networkTypes = []string{"Network", "DistributedVirtualPortgroup", "OpaqueNetwork"}
+
+// FromID locates a standard network, distributed port group or opaque network
+// by its managed object ID.
+func FromID(client *govmomi.Client, id string) (object.NetworkReference, error) {
+	log.Printf("[DEBUG] Locating network with ID %q", id)
+	finder := find.NewFinder(client.Client, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// try the type the ID prefix suggests first, vCenter uses "network-" for
+	// both standard and opaque networks.
+	candidates := networkTypes
+	if strings.HasPrefix(id, "dvportgroup-") {
+		candidates = []string{"DistributedVirtualPortgroup"}
+	}
+
+	var lastErr error
+	for _, t := range candidates {
+		ref := types.ManagedObjectReference{Type: t, Value: id}
+		obj, err := finder.ObjectReference(ctx, ref)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		net, ok := obj.(object.NetworkReference)
+		if !ok {
+			return nil, fmt.Errorf("%s %q is not a network", t, id)
+		}
+		log.Printf("[DEBUG] Network with ID %q found: %s", id, t)
+		return net, nil
+	}
+
+	return nil, fmt.Errorf("could not find network with ID %q: %s", id, lastErr)
+}
+
+// FromName locates a standard network, distributed port group or opaque
+// network by its name or inventory path in the datacenter. Distributed
+// switches and uplink port groups are ignored.
+func FromName(ctx context.Context, client *govmomi.Client, dc *object.Datacenter, name string) (object.NetworkReference, error) {
+	log.Printf("[DEBUG] Locating network %q", name)
+	finder := find.NewFinder(client.Client, false)
+	finder.SetDatacenter(dc)
+
+	all, err := finder.NetworkList(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var networks []object.NetworkReference
+	for _, n := range all {
+		switch net := n.(type) {
+		case *object.Network, *object.OpaqueNetwork:
+			networks = append(networks, n)
+		case *object.DistributedVirtualPortgroup:
+			uplink, err := isUplink(ctx, net)
+			if err != nil {
+				return nil, err
+			}
+			if !uplink {
+				networks = append(networks, n)
+			}
+		}
+	}
+
+	switch len(networks) {
+	case 0:
+		return nil, fmt.Errorf("network %q not found", name)
+	case 1:
+		log.Printf("[DEBUG] Network %q found: %s", name, networks[0].Reference())
+		return networks[0], nil
+	}
+
+	var ids []string
+	for _, n := range networks {
+		ids = append(ids, n.Reference().Value)
+	}
+	return nil, fmt.Errorf("network %q is ambiguous, use one of the IDs %s instead", name, strings.Join(ids, ", "))
+}
+
+func isUplink(ctx context.Context, pg *object.DistributedVirtualPortgroup) (bool, error) {
+	var props mo.DistributedVirtualPortgroup
+	if err := pg.Properties(ctx, pg.Reference(), []string{"config.uplink"}, &props); err != nil {
+		return false, err
+	}
+	return props.Config.Uplink != nil && *props.Config.Uplink, nil
+}
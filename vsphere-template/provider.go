@@ -14,7 +14,7 @@ import (
 const defaultAPITimeout = time.Minute * 60
 
 func Provider() terraform.ResourceProvider {
-	return &schema.Provider{
+	p := &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"user": {
 				Type:        schema.TypeString,
@@ -86,15 +86,29 @@ func Provider() terraform.ResourceProvider {
 		ResourcesMap: map[string]*schema.Resource{
 			"vspheretemplate_ova_template": resourceVspheretemplateOvaTemplate(),
 		},
-		ConfigureFunc: providerConfigure,
+		DataSourcesMap: map[string]*schema.Resource{
+			"vspheretemplate_ova_spec": dataSourceVspheretemplateOvaSpec(),
+		},
 	}
+	p.ConfigureFunc = providerConfigure(p)
+	return p
 }
 
-func providerConfigure(d *schema.ResourceData) (interface{}, error) {
-	c, err := NewConfig(d)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load the config: %s", err)
-	}
+func providerConfigure(p *schema.Provider) schema.ConfigureFunc {
+	return func(d *schema.ResourceData) (interface{}, error) {
+		c, err := NewConfig(d)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the config: %s", err)
+		}
 
-	return c.Client()
+		client, err := c.Client()
+		if err != nil {
+			return nil, err
+		}
+
+		return &VSphereClient{
+			vimClient: client,
+			stopCtx:   p.StopContext(),
+		}, nil
+	}
 }
@@ -2,55 +2,93 @@ package vsphere_template
 
 import (
 	"fmt"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/terraform/helper/schema"
-	"io/ioutil"
 	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
-	"bytes"
 	"context"
+	"crypto/sha1"
 	"errors"
 	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/archive"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/computecluster"
 	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/datacenter"
 	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/datastore"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/descriptor"
 	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/folder"
 	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/hostsystem"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/network"
 	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/resourcepool"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/storagepod"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/storagepolicy"
 	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/virtualmachine"
 	"github.com/vmware/govmomi"
-	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/nfc"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
+// rollbackTimeout is the time given to clean up after a failed import.
+const rollbackTimeout = time.Minute * 5
+
 func resourceVspheretemplateOvaTemplate() *schema.Resource {
-	return &schema.Resource{
+	r := &schema.Resource{
 		Create: resourceVspheretemplateOvaTemplateCreate,
 		Read:   resourceVspheretemplateOvaTemplateRead,
+		Update: resourceVspheretemplateOvaTemplateUpdate,
 		Delete: resourceVspheretemplateOvaTemplateDelete,
 
+		CustomizeDiff: resourceVspheretemplateOvaTemplateCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(defaultAPITimeout),
+			Delete: schema.DefaultTimeout(defaultAPITimeout),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"datacenter_id": {
 				Type:        schema.TypeString,
 				Optional:    true,
+				Computed:    true,
 				ForceNew:    true,
-				Description: "The ID of the virtual machine's datacenter.",
+				Description: "The ID of the virtual machine's datacenter. The datacenter is derived from the resource pool and datastore; if set, it has to match them.",
 			},
 			"datastore_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "The ID of the virtual machine's datastore. The virtual machine configuration is placed here, along with any virtual disks that are created without datastores.",
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"datastore_cluster_id"},
+				Description:   "The ID of the virtual machine's datastore. The virtual machine configuration is placed here, along with any virtual disks that are created without datastores.",
+			},
+			"datastore_cluster_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"datastore_id"},
+				Description:   "The ID of a datastore cluster to put the virtual machine in. Storage DRS picks the datastore, which is exported as datastore_id.",
 			},
 			"folder": {
 				Type:        schema.TypeString,
-				// TODO: make this optional
-				Required:    true,
+				Optional:    true,
 				ForceNew:    true,
-				Description: "The name of the folder to locate the virtual machine in.",
-				//StateFunc:   folder.NormalizePath,
+				Description: "The folder to locate the virtual machine in, either a managed object ID, an absolute path, or a path relative to the VM folder of the datacenter. Defaults to the VM folder of the datacenter.",
+				StateFunc:   folder.NormalizePath,
+			},
+			"create_folder": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Create the folder, and any missing parent folders below the VM folder of the datacenter, if it does not exist.",
 			},
 			"host_system_id": {
 				Type:        schema.TypeString,
@@ -75,19 +113,127 @@ func resourceVspheretemplateOvaTemplate() *schema.Resource {
 						"name": {
 							Type:     schema.TypeString,
 							Required: true,
+							ForceNew: true,
 						},
 						"network": {
-							Type:     schema.TypeString,
-							Required: true,
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "The name or inventory path of the network. Conflicts with network_id.",
+						},
+						"network_id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "The managed object ID of a standard network, distributed port group or opaque network. Conflicts with network.",
 						},
 					},
 				},
 			},
-			"resource_pool_id": {
+			"default_network": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"default_network_id"},
+				Description:   "The name or inventory path of the network to map every OVF network to that is not listed in network_mapping.",
+			},
+			"default_network_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"default_network"},
+				Description:   "The managed object ID of the network to map every OVF network to that is not listed in network_mapping.",
+			},
+			"deployment_option": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "The ID of the ovf deployment option to import. Defaults to the default option of the ovf.",
+			},
+			"disk_provisioning": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateDiskProvisioning,
+				Description:  "The disk provisioning type of the imported disks, e.g. thin, thick or eagerZeroedThick.",
+			},
+			"disk": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Placement, provisioning type and storage policy of single disks of the ovf.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"disk_id": {
+							Type:        schema.TypeString,
+							Required:    true,
+							ForceNew:    true,
+							Description: "The ID of the disk in the DiskSection of the ovf.",
+						},
+						"datastore_id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "The ID of the datastore to put the disk on. Defaults to the datastore of the template.",
+						},
+						"provisioning": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateDiskBlockProvisioning,
+							Description:  "The provisioning type of the disk, thin, thick or eagerZeroedThick. Defaults to disk_provisioning.",
+						},
+						"storage_policy_id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The ID of the storage policy of the disk.",
+						},
+						"size": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Computed:     true,
+							ValidateFunc: validatePositive,
+							Description:  "The size of the disk in GB. Disks are grown to this size after the import, and can only grow.",
+						},
+						"key": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "The device key of the disk in the template, if it belongs to the first virtual machine.",
+						},
+					},
+				},
+			},
+			"extra_config": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Description: "Extra configuration keys of the template, like guestinfo.* keys.",
+			},
+			"vapp": vAppSchema(),
+			"storage_policy_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The ID of the storage policy of the template's home files and of every disk without a storage policy of its own.",
+			},
+			"properties": {
+				Type:        schema.TypeMap,
+				Optional:    true,
 				ForceNew:    true,
-				Description: "The ID of a resource pool to put the virtual machine in.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Values of the ovf properties, by property key.",
+			},
+			"resource_pool_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"cluster_id"},
+				Description:   "The ID of a resource pool to put the virtual machine in.",
+			},
+			"cluster_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"resource_pool_id"},
+				Description:   "The ID of a compute cluster to put the virtual machine in. The root resource pool of the cluster is used, and a suitable host is picked unless host_system_id is set.",
 			},
 			"ova_file_path": {
 				Type:        schema.TypeString,
@@ -95,246 +241,1653 @@ func resourceVspheretemplateOvaTemplate() *schema.Resource {
 				ForceNew:    true,
 				Description: "path to the ova file.",
 			},
+			"ova_sha256": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The sha256 sum of the ova file. A change of the file contents forces a new template.",
+			},
+			"ova_file_size": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The size of the ova file ova_sha256 was computed for.",
+			},
+			"ova_file_mtime": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The modification time of the ova file ova_sha256 was computed for.",
+			},
+			"uuid": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateUUID,
+				StateFunc:    normalizeUUID,
+				Description:  "The UUID of the template. If not set, a UUID is derived from the vCenter, the datacenter, folder and name, so it is known at plan time.",
+			},
 			"guest_id": {
 				Type:        schema.TypeString,
 				Description: "The guest ID of the virtual machine.",
 				Computed:    true,
 			},
+			"annotation": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "User-provided description of the template.",
+			},
+			"template": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Whether the imported virtual machine is marked as a template.",
+			},
+			"accept_eula": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+				Description: "Accept the license agreements of the ovf. Importing an ovf with an EulaSection fails unless this is set.",
+			},
+			"descriptor_fixups": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+				Description: "Fix up ovfs exported by VirtualBox or Workstation: remove sound cards and USB controllers, rename controller types and replace non-vSphere virtual system types.",
+			},
+			"hardware_rule": hardwareRuleSchema(),
+			"import_spec_override": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateImportSpecOverride,
+				StateFunc:    normalizeImportSpecOverride,
+				Description:  "A JSON object of VirtualMachineConfigSpec fields to set in the import spec, e.g. {\"cpuHotAddEnabled\": true}.",
+			},
+			"allow_hw_downgrade": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+				Description: "Import with the newest virtual hardware version the target supports if the ovf requires a newer one.",
+			},
+			"virtual_system_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      virtualSystemModeTemplates,
+				ValidateFunc: validateVirtualSystemModeValue,
+				Description:  "How to import an ovf with a VirtualSystemCollection: templates imports one template per virtual system, vapp imports a vApp.",
+			},
+			"virtual_system_uuids": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The UUIDs of all imported virtual machines, in the order of the ovf. The first one is uuid.",
+			},
+			"virtual_system_names": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The names of all imported virtual machines, in the order of virtual_system_uuids.",
+			},
+			"vapp_id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The managed object ID of the vApp, if the ovf was imported as a vApp.",
+			},
+			"preflight": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Ask vSphere to validate the import against the configured resource pool, datastore and host during plan.",
+			},
+			"import_warnings": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The warnings vSphere reported for the import spec of the template.",
+			},
+			"recreate_if_inaccessible": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Plan a replacement when the template becomes orphaned or inaccessible. If false, the template is removed from the state instead.",
+			},
+			"inaccessible": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether vSphere reports the template as orphaned or inaccessible.",
+			},
 		},
 	}
+
+	for k, v := range hardwareSchema() {
+		r.Schema[k] = v
+	}
+
+	return r
 }
 
 func resourceVspheretemplateOvaTemplateCreate(d *schema.ResourceData, m interface{}) error {
-	ctx := context.Background()
-	client := m.(*govmomi.Client)
-
-	// retrieve iaas information
-	ds, err := datastore.FromID(client, d.Get("datastore_id").(string))
-	if err != nil {
-		return fmt.Errorf("error locating datastore for VM: %s", err)
-	}
+	meta := m.(*VSphereClient)
+	client := meta.vimClient
 
-	var hs *object.HostSystem
-	if v, ok := d.GetOk("host_system_id"); ok {
-		hsID := v.(string)
-		var err error
-		if hs, err = hostsystem.FromID(client, hsID); err != nil {
-			return fmt.Errorf("error locating host system at ID %q: %s", hsID, err)
-		}
-	}
+	ctx, cancel := context.WithTimeout(meta.stopCtx, d.Timeout(schema.TimeoutCreate))
+	defer cancel()
 
-	poolID := d.Get("resource_pool_id").(string)
-	pool, err := resourcepool.FromID(client, poolID)
+	p, err := resolvePlacement(ctx, client, d)
 	if err != nil {
-		return fmt.Errorf("could not find resource pool ID %q: %s", poolID, err)
+		return err
 	}
+	d.Set("resource_pool_id", p.pool.Reference().Value)
+	d.Set("datacenter_id", p.datacenter.Reference().Value)
 
 	ovaPath := d.Get("ova_file_path").(string)
-	archive := archive.NewTapeArchive(ovaPath, archive.Opener{Downloader: client})
+	archive := archive.NewTapeArchive(ctx, ovaPath, archive.Opener{Downloader: client})
 
-	// load ovf file
-	reader, _, err := archive.Open("*.ovf")
+	desc, err := descriptor.Load(archive)
 	if err != nil {
 		return err
 	}
-
-	defer reader.Close()
-	ovfContent, err := ioutil.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read ovf: %s", err)
+	if err := transformDescriptor(d, desc); err != nil {
+		return err
 	}
-	e, err := ovf.Unmarshal(bytes.NewReader(ovfContent))
-	if err != nil {
-		return fmt.Errorf("failed to parse ovf: %s", err)
+	if err := validateVirtualSystemMode(d, desc); err != nil {
+		return err
+	}
+	if err := validateEula(d, desc); err != nil {
+		return err
+	}
+	if err := checkCompatibility(d, client, p, desc); err != nil {
+		return err
 	}
 
 	// set appliance properties
-	cisp, err := createImportSpecParams(d, e, client)
+	cisp, err := createImportSpecParams(ctx, d, desc.Envelope, client, p.datacenter)
 	if err != nil {
 		return err
 	}
 
-	ovfManager := ovf.NewManager(client.Client)
-
-	spec, err := ovfManager.CreateImportSpec(
-		ctx, string(ovfContent),
-		pool, ds, cisp)
+	folder, err := folder.FromPathOrID(ctx, client, p.datacenter, d.Get("folder").(string), d.Get("create_folder").(bool))
 	if err != nil {
 		return err
 	}
-	if spec.Error != nil {
-		return errors.New(spec.Error[0].LocalizedMessage)
-	}
-	if spec.Warning != nil {
-		for _, w := range spec.Warning {
-			log.Printf("[WARN] %s\n", w.LocalizedMessage)
-		}
-	}
 
-	// TODO: add annotation @ importx/ovf.go:288
-
-	folder, err := folder.FromName(client, d.Get("folder").(string))
-	if err != nil {
+	if err := checkUUIDUnused(client, d.Get("uuid").(string)); err != nil {
 		return err
 	}
 
-	lease, err := pool.ImportVApp(ctx, spec.ImportSpec, folder, hs)
+	if err := validateStoragePolicies(ctx, d, client); err != nil {
+		return err
+	}
+	configs, err := diskConfigs(client, d)
 	if err != nil {
 		return err
 	}
-
-	info, err := lease.Wait(ctx, spec.FileItem)
+	sizes, err := desc.DiskSizes()
 	if err != nil {
 		return err
 	}
+	growDiskSizes(d, sizes)
+	systemDisks := desc.SystemDisks()
 
-	u := lease.StartUpdater(ctx, info)
-	defer u.Done()
-
-	for _, i := range info.Items {
-		err = upload(ctx, lease, i, archive)
+	var results []*importResult
+	systems := desc.VirtualSystems()
+	if len(systems) > 0 && d.Get("virtual_system_mode").(string) == virtualSystemModeTemplates {
+		// import every virtual system of the collection as a template of its
+		// own, named after the virtual system. The first one gets the planned
+		// UUID.
+		if p.pod == nil {
+			// the disks of all virtual systems go to the same datastores, they
+			// have to fit together before the first one is imported. Storage
+			// DRS places every virtual system on its own.
+			all := diskPlan{systems: systemDisks, configs: configs, sizes: sizes}
+			if err := checkFreeSpace(all, p.datastore, cisp.DiskProvisioning); err != nil {
+				return err
+			}
+		}
+		for i, vs := range systems {
+			content, err := desc.Split(vs.ID)
+			if err != nil {
+				return rollbackResults(client, results, err)
+			}
+			vsCisp := cisp
+			if len(systems) > 1 {
+				vsCisp.EntityName = fmt.Sprintf("%s-%s", cisp.EntityName, vs.ID)
+			}
+			uuid := ""
+			if i == 0 {
+				uuid = d.Get("uuid").(string)
+			}
+			disks := diskPlan{systems: systemDisks[i : i+1], configs: configs, sizes: sizes}
+			r, err := importDescriptor(ctx, d, client, *p, folder, content, vsCisp, archive, uuid, disks)
+			if err != nil {
+				return rollbackResults(client, results, err)
+			}
+			results = append(results, r)
+		}
+	} else {
+		disks := diskPlan{systems: systemDisks, configs: configs, sizes: sizes}
+		r, err := importDescriptor(ctx, d, client, *p, folder, desc.Content, cisp, archive, d.Get("uuid").(string), disks)
 		if err != nil {
 			return err
 		}
+		results = append(results, r)
 	}
 
-	moref := info.Entity
-	err = lease.Complete(ctx)
-	if err != nil {
-		return err
+	d.Set("datastore_id", results[0].datastore.Reference().Value)
+	var warnings []string
+	for _, r := range results {
+		warnings = append(warnings, r.warnings...)
 	}
+	d.Set("import_warnings", warnings)
 
-	vm := object.NewVirtualMachine(client.Client, moref)
-	d.SetId(vm.UUID(ctx))
+	var vms []*object.VirtualMachine
+	for _, r := range results {
+		if r.entity.Type == "VirtualApp" {
+			d.Set("vapp_id", r.entity.Value)
+			children, err := virtualAppChildren(ctx, client, r.entity, r.children)
+			if err != nil {
+				return rollbackResults(client, results, err)
+			}
+			vms = append(vms, children...)
+			continue
+		}
+		vms = append(vms, object.NewVirtualMachine(client.Client, r.entity))
+	}
+	if len(vms) == 0 {
+		return rollbackResults(client, results, errors.New("the ova did not contain any virtual machine"))
+	}
 
-	hs, err = vm.HostSystem(ctx)
+	props, err := virtualmachine.Properties(vms[0])
 	if err != nil {
-		return err
+		return rollbackResults(client, results, fmt.Errorf("error fetching virtual machine properties: %s", err))
 	}
-	d.Set("host_system_id", hs.Reference().Value)
+	setDiskKeys(d, props, diskPlan{systems: systemDisks}.ids(0))
 
-	props, err := virtualmachine.Properties(vm)
-	if err != nil {
-		return fmt.Errorf("error fetching virtual machine properties: %s", err)
+	uuids := make([]string, len(vms))
+	for i, vm := range vms {
+		if err := reconfigureImport(ctx, d, vm, i == 0); err != nil {
+			return rollbackResults(client, results, err)
+		}
+		if err := finishImport(ctx, d, vm); err != nil {
+			return rollbackResults(client, results, err)
+		}
+		uuids[i] = vm.UUID(ctx)
 	}
-	if props.Config == nil {
-		return fmt.Errorf("no configuration returned for virtual machine %q", vm.InventoryPath)
+
+	// other resources of the plan refer to the planned UUID, so a template
+	// with another UUID is of no use to them.
+	uuid := uuids[0]
+	if planned := d.Get("uuid").(string); planned != "" && !strings.EqualFold(planned, uuid) {
+		return rollbackResults(client, results, fmt.Errorf("vSphere assigned UUID %q instead of %q to the template", uuid, planned))
 	}
+	d.SetId(uuid)
+	d.Set("uuid", uuid)
+	d.Set("virtual_system_uuids", uuids)
+	return resourceVspheretemplateOvaTemplateRead(d, m)
+}
 
-	d.Set("guest_id", props.Config.GuestId)
+const (
+	virtualSystemModeTemplates = "templates"
+	virtualSystemModeVApp      = "vapp"
+)
 
-	log.Printf("[INFO] Marking VM as template...\n")
-	return vm.MarkAsTemplate(ctx)
+// validateVirtualSystemMode rejects templates for virtual machines imported
+// into a vApp, vSphere cannot mark them as templates. vApps cannot be placed
+// on a datastore cluster either, Storage DRS only places virtual machines.
+func validateVirtualSystemMode(d resourceGetter, desc *descriptor.Descriptor) error {
+	if len(desc.VirtualSystems()) == 0 || d.Get("virtual_system_mode").(string) != virtualSystemModeVApp {
+		return nil
+	}
+	if d.Get("template").(bool) {
+		return errors.New("virtual machines in a vApp cannot be templates, set template = false with virtual_system_mode = \"vapp\"")
+	}
+	if d.Get("datastore_cluster_id").(string) != "" {
+		return errors.New("a vApp cannot be placed on a datastore cluster, set datastore_id instead of datastore_cluster_id with virtual_system_mode = \"vapp\"")
+	}
+	return nil
 }
 
-func createImportSpecParams(
-	d *schema.ResourceData,
-	envelope *ovf.Envelope,
-	c *govmomi.Client) (types.OvfCreateImportSpecParams, error) {
-	var err error
+// validateEula refuses ovfs with license agreements unless they have been
+// accepted explicitly.
+func validateEula(d resourceGetter, desc *descriptor.Descriptor) error {
+	if len(desc.Eulas()) > 0 && !d.Get("accept_eula").(bool) {
+		return errors.New("the ova contains a license agreement, read it (e.g. in the eulas of the vspheretemplate_ova_spec data source) and set accept_eula = true to accept it")
+	}
+	return nil
+}
 
-	vAppName := d.Get("name").(string)
+// importResult describes an entity imported by importDescriptor.
+type importResult struct {
+	entity types.ManagedObjectReference
+	// datastore is the datastore the entity was imported to.
+	datastore *object.Datastore
+	// children are the names of the virtual machines of an imported vApp, in
+	// the order of the ovf.
+	children []string
+	warnings []string
+}
 
-	networkMapping := func(e *ovf.Envelope) (p []types.OvfNetworkMapping) {
-		ctx := context.TODO()
-		finder := find.NewFinder(c.Client, false)
-		dc, err1 := datacenter.FromIDOrDefault(c, d.Get("datacenter_id").(string))
-		if err1 != nil {
-			err = err1
-			return
-		}
-		finder.SetDatacenter(dc)
+// importDescriptor imports the ovf content to the placement: it creates the
+// import spec, lets Storage DRS and the cluster pick the datastore and host,
+// places the disks, checks the datastores have enough space for them, and
+// uploads the files of the ova. The import is rolled back if it fails.
+func importDescriptor(
+	ctx context.Context,
+	d *schema.ResourceData,
+	client *govmomi.Client,
+	p importPlacement,
+	folder *object.Folder,
+	content string,
+	cisp types.OvfCreateImportSpecParams,
+	archive archive.Archive,
+	uuid string,
+	disks diskPlan) (*importResult, error) {
+	ovfManager := ovf.NewManager(client.Client)
 
-		networks := map[string]string{}
+	spec, err := ovfManager.CreateImportSpec(ctx, content, p.pool, p.datastore, cisp)
+	if err != nil {
+		return nil, err
+	}
 
-		if e.Network != nil {
-			for _, net := range e.Network.Networks {
-				networks[net.Name] = net.Name
+	if p.pod != nil && spec.Error == nil {
+		if vmSpec, ok := spec.ImportSpec.(*types.VirtualMachineImportSpec); ok {
+			p.datastore, err = storagepod.RecommendDatastore(ctx, client, p.pod, p.pool, p.host, folder, vmSpec.ConfigSpec)
+			if err != nil {
+				return nil, fmt.Errorf("error placing template on datastore cluster: %s", err)
+			}
+			spec, err = ovfManager.CreateImportSpec(ctx, content, p.pool, p.datastore, cisp)
+			if err != nil {
+				return nil, err
 			}
 		}
+	}
 
-		networkMappings := d.Get("network_mapping").([]interface{})
-
-		for _, net := range networkMappings {
-			netMap := net.(map[string]interface{})
-			networks[netMap["name"].(string)] = netMap["network"].(string)
+	if p.cluster != nil && p.host == nil {
+		networks := make([]types.ManagedObjectReference, len(cisp.NetworkMapping))
+		for i, n := range cisp.NetworkMapping {
+			networks[i] = n.Network
 		}
-
-		for src, dst := range networks {
-			if net, err1 := finder.Network(ctx, dst); err1 == nil {
-				p = append(p, types.OvfNetworkMapping{
-					Name:    src,
-					Network: net.Reference(),
-				})
-			} else {
-				err = err1
-				return
-			}
+		datastores := diskDatastores(p.datastore, disks.configs)
+		if p.host, err = computecluster.SelectHost(ctx, client, p.cluster, datastores, networks); err != nil {
+			return nil, err
 		}
-		return
+	}
+	if err := importSpecError(spec.Error); err != nil {
+		return nil, err
 	}
 
-	cisp := types.OvfCreateImportSpecParams{
-		EntityName:     vAppName,
-		NetworkMapping: networkMapping(envelope),
+	result := &importResult{
+		datastore: p.datastore,
+		warnings:  importSpecWarnings(spec.Warning),
 	}
 
-	return cisp, err
-}
+	override, err := parseImportSpecOverride(d.Get("import_spec_override").(string))
+	if err != nil {
+		return nil, fmt.Errorf("import_spec_override: %s", err)
+	}
 
-func upload(ctx context.Context, lease *nfc.Lease, item nfc.FileItem, archive archive.Archive) error {
-	file := item.Path
+	annotation := d.Get("annotation").(string)
+	policy := d.Get("storage_policy_id").(string)
+	switch s := spec.ImportSpec.(type) {
+	case *types.VirtualMachineImportSpec:
+		setImportConfig(&s.ConfigSpec, uuid, annotation, policy)
+		applyDiskConfigs(&s.ConfigSpec, disks.ids(0), disks.configs, policy)
+		override.apply(&s.ConfigSpec)
+	case *types.VirtualAppImportSpec:
+		if annotation != "" {
+			s.VAppConfigSpec.Annotation = annotation
+		}
+		for _, child := range s.Child {
+			if vmSpec, ok := child.(*types.VirtualMachineImportSpec); ok {
+				setImportConfig(&vmSpec.ConfigSpec, uuid, annotation, policy)
+				applyDiskConfigs(&vmSpec.ConfigSpec, disks.ids(len(result.children)), disks.configs, policy)
+				override.apply(&vmSpec.ConfigSpec)
+				result.children = append(result.children, vmSpec.ConfigSpec.Name)
+				// only the first virtual machine gets the planned UUID.
+				uuid = ""
+			}
+		}
+	}
 
-	f, size, err := archive.Open(file)
+	if err := checkFreeSpace(disks, p.datastore, cisp.DiskProvisioning); err != nil {
+		return nil, err
+	}
+
+	lease, err := p.pool.ImportVApp(ctx, spec.ImportSpec, folder, p.host)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
 
-	opts := soap.Upload{
-		ContentLength: size,
+	moref, err := importEntity(ctx, lease, spec.FileItem, archive)
+	if err != nil {
+		return nil, rollbackImport(client, lease, moref, err)
 	}
+	result.entity = *moref
 
-	return lease.Upload(ctx, item, f, opts)
+	return result, nil
 }
 
-func resourceVspheretemplateOvaTemplateRead(d *schema.ResourceData, m interface{}) error {
-	client := m.(*govmomi.Client)
+func setImportConfig(spec *types.VirtualMachineConfigSpec, uuid string, annotation string, policy string) {
+	if uuid != "" {
+		spec.Uuid = uuid
+	}
+	if annotation != "" {
+		spec.Annotation = annotation
+	}
+	if policy != "" {
+		spec.VmProfile = storagepolicy.ProfileSpec(policy)
+	}
+}
 
-	vm, err := virtualmachine.FromUUID(client, d.Id())
-	if err != nil {
-		return err
+// virtualAppChildren returns the virtual machines of the vApp, ordered by the
+// given names.
+func virtualAppChildren(ctx context.Context, client *govmomi.Client, ref types.ManagedObjectReference, names []string) ([]*object.VirtualMachine, error) {
+	var vapp mo.VirtualApp
+	pc := property.DefaultCollector(client.Client)
+	if err := pc.RetrieveOne(ctx, ref, []string{"vm"}, &vapp); err != nil {
+		return nil, fmt.Errorf("error fetching virtual machines of vApp %q: %s", ref.Value, err)
 	}
 
-	if vm == nil {
-		d.SetId("")
+	var vms []mo.VirtualMachine
+	if len(vapp.Vm) > 0 {
+		if err := pc.Retrieve(ctx, vapp.Vm, []string{"name"}, &vms); err != nil {
+			return nil, fmt.Errorf("error fetching virtual machines of vApp %q: %s", ref.Value, err)
+		}
 	}
 
-	return nil
+	order := map[string]int{}
+	for i, name := range names {
+		order[name] = i
+	}
+	sort.SliceStable(vms, func(i, j int) bool {
+		oi, ok := order[vms[i].Name]
+		if !ok {
+			oi = len(names)
+		}
+		oj, ok := order[vms[j].Name]
+		if !ok {
+			oj = len(names)
+		}
+		return oi < oj
+	})
+
+	result := make([]*object.VirtualMachine, len(vms))
+	for i, vm := range vms {
+		result[i] = object.NewVirtualMachine(client.Client, vm.Reference())
+	}
+	return result, nil
 }
 
-func resourceVspheretemplateOvaTemplateDelete(d *schema.ResourceData, m interface{}) error {
-	ctx := context.Background()
-	client := m.(*govmomi.Client)
+// rollbackResults destroys the entities imported so far after a later step of
+// the import failed.
+func rollbackResults(client *govmomi.Client, results []*importResult, err error) error {
+	for _, r := range results {
+		err = rollbackImport(client, nil, &r.entity, err)
+	}
+	return err
+}
 
-	id := d.Id()
+// importPlacement holds the inventory objects an ova is imported to.
+type importPlacement struct {
+	pool       *object.ResourcePool
+	cluster    *object.ClusterComputeResource
+	datastore  *object.Datastore
+	pod        *object.StoragePod
+	host       *object.HostSystem
+	datacenter *object.Datacenter
+}
 
-	vm, err := virtualmachine.FromUUID(client, id)
-	if err != nil || vm == nil {
-		return fmt.Errorf("cannot locate virtual machine with UUID %q", id)
+// resolvePlacement locates the resource pool (or cluster), datastore (or
+// datastore cluster), host and datacenter configured for the template. For a
+// datastore cluster, datastore is any datastore of the cluster until Storage
+// DRS picked one.
+func resolvePlacement(ctx context.Context, client *govmomi.Client, d resourceGetter) (*importPlacement, error) {
+	p := &importPlacement{}
+	var err error
+
+	if v, ok := d.GetOk("datastore_cluster_id"); ok {
+		podID := v.(string)
+		if p.pod, err = storagepod.FromID(client, podID); err != nil {
+			return nil, fmt.Errorf("error locating datastore cluster at ID %q: %s", podID, err)
+		}
+		// an import spec can only be created for a datastore, start with any
+		// datastore of the cluster until Storage DRS picked one.
+		if p.datastore, err = storagepod.AnyDatastore(client, p.pod); err != nil {
+			return nil, err
+		}
+	} else if v, ok := d.GetOk("datastore_id"); ok {
+		if p.datastore, err = datastore.FromID(client, v.(string)); err != nil {
+			return nil, fmt.Errorf("error locating datastore for VM: %s", err)
+		}
+	} else {
+		return nil, errors.New("one of datastore_id or datastore_cluster_id must be provided")
 	}
 
-	task, err := vm.Destroy(ctx)
-	if err != nil {
-		return err
+	if v, ok := d.GetOk("host_system_id"); ok {
+		hsID := v.(string)
+		if p.host, err = hostsystem.FromID(client, hsID); err != nil {
+			return nil, fmt.Errorf("error locating host system at ID %q: %s", hsID, err)
+		}
+	}
+
+	if v, ok := d.GetOk("cluster_id"); ok {
+		clusterID := v.(string)
+		if p.cluster, err = computecluster.FromID(client, clusterID); err != nil {
+			return nil, fmt.Errorf("could not find compute cluster ID %q: %s", clusterID, err)
+		}
+		if p.pool, err = p.cluster.ResourcePool(ctx); err != nil {
+			return nil, fmt.Errorf("could not find root resource pool of compute cluster %q: %s", clusterID, err)
+		}
+	} else if v, ok := d.GetOk("resource_pool_id"); ok {
+		poolID := v.(string)
+		if p.pool, err = resourcepool.FromID(client, poolID); err != nil {
+			return nil, fmt.Errorf("could not find resource pool ID %q: %s", poolID, err)
+		}
+	} else {
+		return nil, errors.New("one of resource_pool_id or cluster_id must be provided")
 	}
 
-	err = task.Wait(ctx)
+	refs := []types.ManagedObjectReference{p.pool.Reference(), p.datastore.Reference()}
+	if p.pod != nil {
+		refs[1] = p.pod.Reference()
+	}
+	if p.datacenter, err = placementDatacenter(client, d.Get("datacenter_id").(string), refs...); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// importEntity waits for the import lease, uploads the files of the ova and
+// completes the lease. It returns the imported entity as soon as it is known,
+// even if the import fails afterwards.
+func importEntity(ctx context.Context, lease *nfc.Lease, items []types.OvfFileItem, archive archive.Archive) (*types.ManagedObjectReference, error) {
+	info, err := lease.Wait(ctx, items)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	d.SetId("")
-	log.Printf("[DEBUG] %q: Delete complete", id)
-	return nil
+	u := lease.StartUpdater(ctx, info)
+	defer u.Done()
+
+	for _, i := range info.Items {
+		err = upload(ctx, lease, i, archive)
+		if err != nil {
+			return &info.Entity, err
+		}
+	}
+
+	return &info.Entity, lease.Complete(ctx)
+}
+
+// reconfigureImport upgrades the virtual hardware of an imported virtual
+// machine and applies num_cpus, memory, extra_config, the vapp block and, for
+// the first virtual machine, the disk sizes, before it is marked as template.
+func reconfigureImport(ctx context.Context, d *schema.ResourceData, vm *object.VirtualMachine, primary bool) error {
+	props, err := virtualmachine.Properties(vm)
+	if err != nil {
+		return fmt.Errorf("error fetching virtual machine properties: %s", err)
+	}
+	if err := upgradeHardware(ctx, d, vm, props); err != nil {
+		return err
+	}
+
+	spec := types.VirtualMachineConfigSpec{}
+	reconfigure := sizingSpec(d, props, &spec)
+	if extraConfigSpec(d, props, &spec) {
+		reconfigure = true
+	}
+	if vAppSpec(d, props, &spec) {
+		reconfigure = true
+	}
+	changes, err := diskChanges(d, props, primary)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		spec.DeviceChange = changes
+		reconfigure = true
+	}
+	if !reconfigure {
+		return nil
+	}
+
+	log.Printf("[INFO] Reconfiguring VM...\n")
+	if err := virtualmachine.Reconfigure(ctx, vm, spec); err != nil {
+		return fmt.Errorf("error reconfiguring virtual machine %q: %s", vm.InventoryPath, err)
+	}
+	return nil
+}
+
+// finishImport marks the imported virtual machine as a template.
+func finishImport(ctx context.Context, d *schema.ResourceData, vm *object.VirtualMachine) error {
+	if !d.Get("template").(bool) {
+		return nil
+	}
+
+	log.Printf("[INFO] Marking VM as template...\n")
+	return vm.MarkAsTemplate(ctx)
+}
+
+// rollbackImport cleans up after a failed import: it aborts the lease with
+// the error as fault, if the lease is still open, and destroys the entity
+// created by the import, if any. The context of the import may already be
+// cancelled at this point, so a fresh one is used. The returned error
+// contains err and every error hit while cleaning up.
+func rollbackImport(client *govmomi.Client, lease *nfc.Lease, entity *types.ManagedObjectReference, err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	result := multierror.Append(nil, err)
+
+	if lease != nil {
+		log.Printf("[DEBUG] Aborting import lease: %s", err)
+		fault := &types.LocalizedMethodFault{
+			Fault:            &types.SystemError{Reason: err.Error()},
+			LocalizedMessage: err.Error(),
+		}
+		if aerr := lease.Abort(ctx, fault); aerr != nil {
+			result = multierror.Append(result, fmt.Errorf("error aborting import lease: %s", aerr))
+		}
+	}
+
+	if entity != nil {
+		log.Printf("[DEBUG] Destroying imported entity %q", entity.Value)
+		if derr := destroyEntity(ctx, client, *entity); derr != nil {
+			result = multierror.Append(result, fmt.Errorf("error destroying imported entity %q: %s", entity.Value, derr))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// destroyEntity destroys the managed entity. Entities that do not exist (any
+// more) are ignored, as aborting a lease normally removes the entity already.
+func destroyEntity(ctx context.Context, client *govmomi.Client, ref types.ManagedObjectReference) error {
+	task, err := object.NewCommon(client.Client, ref).Destroy(ctx)
+	if err != nil {
+		if soap.IsSoapFault(err) {
+			if _, ok := soap.ToSoapFault(err).VimFault().(types.ManagedObjectNotFound); ok {
+				return nil
+			}
+		}
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// placementDatacenter returns the datacenter the placement objects are in. An
+// error is returned if they are in different datacenters, or if a configured
+// datacenter ID contradicts them.
+func placementDatacenter(client *govmomi.Client, configuredID string, refs ...types.ManagedObjectReference) (*object.Datacenter, error) {
+	var dc *object.Datacenter
+	var from types.ManagedObjectReference
+	for _, ref := range refs {
+		found, err := datacenter.FromObject(client, ref)
+		if err != nil {
+			return nil, fmt.Errorf("error locating datacenter of %s %q: %s", ref.Type, ref.Value, err)
+		}
+
+		if dc != nil && found.Reference() != dc.Reference() {
+			return nil, fmt.Errorf(
+				"%s %q is in datacenter %q, but %s %q is in datacenter %q",
+				from.Type, from.Value, dc.InventoryPath, ref.Type, ref.Value, found.InventoryPath)
+		}
+		dc, from = found, ref
+	}
+
+	if dc == nil {
+		return datacenter.FromIDOrDefault(client, configuredID)
+	}
+
+	if configuredID != "" && configuredID != dc.Reference().Value {
+		return nil, fmt.Errorf(
+			"datacenter_id %q does not match datacenter %q (%s) of %s %q",
+			configuredID, dc.InventoryPath, dc.Reference().Value, from.Type, from.Value)
+	}
+
+	return dc, nil
+}
+
+func createImportSpecParams(
+	ctx context.Context,
+	d resourceGetter,
+	envelope *ovf.Envelope,
+	c *govmomi.Client,
+	dc *object.Datacenter) (types.OvfCreateImportSpecParams, error) {
+	vAppName := d.Get("name").(string)
+
+	networkMapping, err := networkMappings(ctx, d, envelope, c, dc)
+
+	cisp := types.OvfCreateImportSpecParams{
+		OvfManagerCommonParams: types.OvfManagerCommonParams{
+			DeploymentOption: d.Get("deployment_option").(string),
+		},
+		EntityName:       vAppName,
+		NetworkMapping:   networkMapping,
+		DiskProvisioning: d.Get("disk_provisioning").(string),
+	}
+
+	for k, v := range d.Get("properties").(map[string]interface{}) {
+		cisp.PropertyMapping = append(cisp.PropertyMapping, types.KeyValue{
+			Key:   k,
+			Value: v.(string),
+		})
+	}
+
+	return cisp, err
+}
+
+// networkMappings maps every network of the ovf, and every network listed in
+// network_mapping, to a network in the datacenter. Networks that are not
+// listed are mapped to the default network if one is set, or to the network
+// with the same name otherwise.
+func networkMappings(
+	ctx context.Context,
+	d resourceGetter,
+	e *ovf.Envelope,
+	c *govmomi.Client,
+	dc *object.Datacenter) ([]types.OvfNetworkMapping, error) {
+	configured := map[string]map[string]interface{}{}
+	var names []string
+	for _, raw := range d.Get("network_mapping").([]interface{}) {
+		netMap := raw.(map[string]interface{})
+		name := netMap["name"].(string)
+		configured[name] = netMap
+		names = append(names, name)
+	}
+
+	if e.Network != nil {
+		for _, net := range e.Network.Networks {
+			if _, ok := configured[net.Name]; !ok {
+				names = append(names, net.Name)
+			}
+		}
+	}
+
+	var p []types.OvfNetworkMapping
+	for _, name := range names {
+		var net object.NetworkReference
+		var err error
+
+		if netMap, ok := configured[name]; ok {
+			net, err = resolveNetwork(ctx, c, dc, netMap["network"].(string), netMap["network_id"].(string))
+			if err != nil {
+				return nil, fmt.Errorf("network_mapping %q: %s", name, err)
+			}
+		} else if d.Get("default_network").(string) != "" || d.Get("default_network_id").(string) != "" {
+			net, err = resolveNetwork(ctx, c, dc, d.Get("default_network").(string), d.Get("default_network_id").(string))
+			if err != nil {
+				return nil, fmt.Errorf("default network: %s", err)
+			}
+		} else {
+			net, err = network.FromName(ctx, c, dc, name)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"ovf network %q is not listed in network_mapping, and cannot be mapped to a network with the same name: %s; "+
+						"add a network_mapping or set default_network", name, err)
+			}
+		}
+
+		p = append(p, types.OvfNetworkMapping{
+			Name:    name,
+			Network: net.Reference(),
+		})
+	}
+
+	return p, nil
+}
+
+// resolveNetwork locates a network by either its name or its managed object
+// ID, exactly one of which has to be set.
+func resolveNetwork(ctx context.Context, c *govmomi.Client, dc *object.Datacenter, name string, id string) (object.NetworkReference, error) {
+	switch {
+	case name != "" && id != "":
+		return nil, errors.New("only one of network or network_id can be set")
+	case id != "":
+		return network.FromID(c, id)
+	case name != "":
+		return network.FromName(ctx, c, dc, name)
+	}
+	return nil, errors.New("one of network or network_id must be set")
+}
+
+func upload(ctx context.Context, lease *nfc.Lease, item nfc.FileItem, archive archive.Archive) error {
+	file := item.Path
+
+	f, size, err := archive.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts := soap.Upload{
+		ContentLength: size,
+	}
+
+	return lease.Upload(ctx, item, f, opts)
+}
+
+func resourceVspheretemplateOvaTemplateRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(*VSphereClient)
+	client := meta.vimClient
+
+	dc, err := templateDatacenter(client, d)
+	if err != nil {
+		return err
+	}
+	vm, err := virtualmachine.FromUUID(client, dc, d.Id())
+	if err != nil {
+		return err
+	}
+
+	if vm == nil {
+		log.Printf("[DEBUG] %q: virtual machine not found, removing from state", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	// states written before datacenter_id was computed look the template up
+	// in every datacenter, save its datacenter to scope later lookups.
+	if dc == nil {
+		found, err := datacenter.FromObject(client, vm.Reference())
+		if err != nil {
+			return err
+		}
+		d.Set("datacenter_id", found.Reference().Value)
+		dc = found
+	}
+
+	props, err := virtualmachine.Properties(vm)
+	if err != nil {
+		return fmt.Errorf("error fetching virtual machine properties: %s", err)
+	}
+
+	usable, reason := virtualmachine.Usable(props)
+	var names []string
+	if usable && multipleVirtualSystems(d) {
+		if names, reason, err = readVirtualSystems(client, dc, d.Get("virtual_system_uuids").([]interface{})); err != nil {
+			return err
+		}
+		usable = reason == ""
+	}
+	if !usable {
+		if !d.Get("recreate_if_inaccessible").(bool) {
+			log.Printf("[WARN] %q: %s, removing from state", d.Id(), reason)
+			d.SetId("")
+			return nil
+		}
+		log.Printf("[WARN] %q: %s, planning replacement", d.Id(), reason)
+		d.Set("inaccessible", true)
+		return nil
+	}
+	d.Set("inaccessible", false)
+
+	if props.Config == nil {
+		return fmt.Errorf("no configuration returned for virtual machine %q", vm.InventoryPath)
+	}
+
+	// the virtual machines of a collection are named after their virtual
+	// system, and the ones in a vApp are not in a folder, so name and folder
+	// are only read back for single templates.
+	if multipleVirtualSystems(d) {
+		d.Set("virtual_system_names", names)
+	} else {
+		d.Set("name", props.Name)
+		if err := readFolder(d, client, vm, props); err != nil {
+			return err
+		}
+		d.Set("virtual_system_uuids", []string{props.Config.Uuid})
+		d.Set("virtual_system_names", []string{props.Name})
+	}
+	d.Set("uuid", props.Config.Uuid)
+	d.Set("guest_id", props.Config.GuestId)
+	d.Set("annotation", props.Config.Annotation)
+	d.Set("template", props.Config.Template)
+	setHardware(d, vm, props)
+	readDiskSizes(d, props)
+	readExtraConfig(d, props)
+	readVApp(d, props)
+	ctx, cancel := context.WithTimeout(meta.stopCtx, defaultAPITimeout)
+	defer cancel()
+	if err := readStoragePolicies(ctx, d, client, vm.Reference()); err != nil {
+		return err
+	}
+
+	d.Set("datastore_id", currentDatastoreID(d.Get("datastore_id").(string), props.Datastore))
+	if props.Runtime.Host != nil {
+		d.Set("host_system_id", props.Runtime.Host.Value)
+	}
+
+	refreshOvaChecksum(d)
+
+	return nil
+}
+
+// multipleVirtualSystems reports whether the resource imported an ovf with a
+// VirtualSystemCollection.
+func multipleVirtualSystems(d resourceGetter) bool {
+	return d.Get("vapp_id").(string) != "" || len(d.Get("virtual_system_uuids").([]interface{})) > 1
+}
+
+// virtualSystemUUIDs returns the UUIDs of all virtual machines imported by the
+// resource. States written before multiple virtual systems were supported
+// only have the ID.
+func virtualSystemUUIDs(d resourceGetter, id string) []string {
+	var uuids []string
+	for _, uuid := range d.Get("virtual_system_uuids").([]interface{}) {
+		uuids = append(uuids, uuid.(string))
+	}
+	if len(uuids) == 0 {
+		uuids = []string{id}
+	}
+	return uuids
+}
+
+// readVirtualSystems returns the names of the virtual machines with the given
+// UUIDs. If any of them is gone or unusable, the reason is returned instead.
+func readVirtualSystems(client *govmomi.Client, dc *object.Datacenter, uuids []interface{}) ([]string, string, error) {
+	var names []string
+	for _, raw := range uuids {
+		uuid := raw.(string)
+		vm, err := virtualmachine.FromUUID(client, dc, uuid)
+		if err != nil {
+			return nil, "", err
+		}
+		if vm == nil {
+			return nil, fmt.Sprintf("virtual machine %q of the collection not found", uuid), nil
+		}
+
+		props, err := virtualmachine.Properties(vm)
+		if err != nil {
+			return nil, "", fmt.Errorf("error fetching virtual machine properties: %s", err)
+		}
+		if usable, reason := virtualmachine.Usable(props); !usable {
+			return nil, fmt.Sprintf("virtual machine %q of the collection: %s", uuid, reason), nil
+		}
+		names = append(names, props.Name)
+	}
+	return names, "", nil
+}
+
+// readFolder saves the parent folder of the virtual machine in the same form
+// as the configured folder.
+func readFolder(d *schema.ResourceData, client *govmomi.Client, vm *object.VirtualMachine, props *mo.VirtualMachine) error {
+	if props.Parent == nil {
+		return fmt.Errorf("virtual machine %q is not in a folder", vm.InventoryPath)
+	}
+
+	dc, err := datacenter.FromObject(client, vm.Reference())
+	if err != nil {
+		return fmt.Errorf("error locating datacenter of virtual machine %q: %s", vm.InventoryPath, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	vmFolder, err := folder.VMFolder(ctx, dc)
+	if err != nil {
+		return fmt.Errorf("error locating VM folder of datacenter %q: %s", dc.InventoryPath, err)
+	}
+
+	d.Set("folder", folder.Normalize(
+		folder.NormalizePath(d.Get("folder")),
+		vmFolder.InventoryPath,
+		*props.Parent,
+		path.Dir(vm.InventoryPath)))
+	return nil
+}
+
+// currentDatastoreID returns the configured datastore if the virtual machine
+// still has files on it, and the first datastore the virtual machine uses
+// otherwise.
+func currentDatastoreID(configured string, datastores []types.ManagedObjectReference) string {
+	for _, ds := range datastores {
+		if ds.Value == configured {
+			return configured
+		}
+	}
+	if len(datastores) > 0 {
+		return datastores[0].Value
+	}
+	return ""
+}
+
+func resourceVspheretemplateOvaTemplateCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	if err := diffInaccessible(d); err != nil {
+		return err
+	}
+	if err := diffUUID(d, m.(*VSphereClient).vimClient); err != nil {
+		return err
+	}
+	if err := diffOvaChecksum(d); err != nil {
+		return err
+	}
+	if err := diffHardware(d); err != nil {
+		return err
+	}
+	return diffDescriptor(d, m.(*VSphereClient).vimClient)
+}
+
+var diskProvisioningTypes = []string{
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeMonolithicSparse),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeMonolithicFlat),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeTwoGbMaxExtentSparse),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeTwoGbMaxExtentFlat),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeThin),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeThick),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeSeSparse),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeEagerZeroedThick),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeSparse),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeFlat),
+}
+
+func validateVirtualSystemModeValue(v interface{}, k string) ([]string, []error) {
+	if v.(string) != virtualSystemModeTemplates && v.(string) != virtualSystemModeVApp {
+		return nil, []error{fmt.Errorf("%q must be %q or %q, got %q", k, virtualSystemModeTemplates, virtualSystemModeVApp, v)}
+	}
+	return nil, nil
+}
+
+func validateDiskProvisioning(v interface{}, k string) ([]string, []error) {
+	for _, t := range diskProvisioningTypes {
+		if v.(string) == t {
+			return nil, nil
+		}
+	}
+	return nil, []error{fmt.Errorf("%q must be one of %s, got %q", k, strings.Join(diskProvisioningTypes, ", "), v)}
+}
+
+// diffDescriptor validates the descriptorKeys against the ovf descriptor of
+// the ova, so that mistakes show up at plan time
+// instead of halfway through an import. All problems are reported at once.
+func diffDescriptor(d *schema.ResourceDiff, client *govmomi.Client) error {
+	changed := d.Id() == ""
+	for _, k := range descriptorKeys {
+		if !d.NewValueKnown(k) {
+			return nil
+		}
+		changed = changed || d.HasChange(k)
+	}
+	if !changed {
+		return nil
+	}
+
+	ovaPath := d.Get("ova_file_path").(string)
+	if ovaPath == "" {
+		return nil
+	}
+	if d.Id() != "" && !d.HasChange("ova_file_path") && !archive.IsRemotePath(ovaPath) {
+		if _, err := os.Stat(ovaPath); os.IsNotExist(err) {
+			log.Printf("[DEBUG] %q: %q does not exist anymore, skipping the descriptor checks", d.Id(), ovaPath)
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	desc, err := descriptor.Load(archive.NewTapeArchive(ctx, ovaPath, archive.Opener{Downloader: client}))
+	if err != nil {
+		return fmt.Errorf("error loading the ovf descriptor of %q: %s", ovaPath, err)
+	}
+	if err := transformDescriptor(d, desc); err != nil {
+		return err
+	}
+
+	var result *multierror.Error
+
+	if err := validateVirtualSystemMode(d, desc); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if err := validateEula(d, desc); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	var names []string
+	for i, raw := range d.Get("network_mapping").([]interface{}) {
+		mapping := raw.(map[string]interface{})
+		names = append(names, mapping["name"].(string))
+		if err := validateNetworkMapping(d, i, mapping); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	if err := desc.ValidateNetworks(names); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	var diskIDs []string
+	for _, raw := range d.Get("disk").([]interface{}) {
+		diskIDs = append(diskIDs, raw.(map[string]interface{})["disk_id"].(string))
+	}
+	if err := desc.ValidateDisks(diskIDs); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if sizes, err := desc.DiskSizes(); err != nil {
+		result = multierror.Append(result, err)
+	} else if err := validateDiskSizes(d, sizes); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if option := d.Get("deployment_option").(string); option != "" {
+		if err := desc.ValidateDeploymentOption(option); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	properties := map[string]string{}
+	for k, v := range d.Get("properties").(map[string]interface{}) {
+		properties[k] = v.(string)
+	}
+	if err := desc.ValidateProperties(properties); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if err := result.ErrorOrNil(); err != nil {
+		return err
+	}
+	if d.Id() == "" && d.Get("preflight").(bool) {
+		return diffPreflight(ctx, d, client, desc)
+	}
+	return nil
+}
+
+// validateNetworkMapping checks that exactly one of network and network_id of
+// a network_mapping entry is set. Entries with an unknown network are skipped.
+func validateNetworkMapping(d *schema.ResourceDiff, i int, mapping map[string]interface{}) error {
+	for _, k := range []string{"network", "network_id"} {
+		if !d.NewValueKnown(fmt.Sprintf("network_mapping.%d.%s", i, k)) {
+			return nil
+		}
+	}
+	switch name, id := mapping["network"].(string), mapping["network_id"].(string); {
+	case name != "" && id != "":
+		return fmt.Errorf("network_mapping %q: only one of network or network_id can be set", mapping["name"])
+	case name == "" && id == "":
+		return fmt.Errorf("network_mapping %q: one of network or network_id must be set", mapping["name"])
+	}
+	return nil
+}
+
+// descriptorKeys are validated against the ovf descriptor.
+var descriptorKeys = []string{
+	"ova_file_path", "network_mapping", "deployment_option", "properties",
+	"virtual_system_mode", "template", "accept_eula", "disk", "descriptor_fixups", "hardware_rule",
+}
+
+// diffPreflight creates the import spec of a new template, and validates the
+// ovf against its host, the same way the import would, and fails the plan on
+// any error vSphere reports. Warnings are planned into import_warnings.
+func diffPreflight(ctx context.Context, d *schema.ResourceDiff, client *govmomi.Client, desc *descriptor.Descriptor) error {
+	for _, k := range preflightKeys {
+		if !d.NewValueKnown(k) {
+			log.Printf("[DEBUG] %s is not known yet, skipping preflight", k)
+			return nil
+		}
+	}
+	if _, ok := d.GetOk("cluster_id"); !ok && !d.NewValueKnown("resource_pool_id") {
+		log.Printf("[DEBUG] resource_pool_id is not known yet, skipping preflight")
+		return nil
+	}
+	if _, ok := d.GetOk("datastore_cluster_id"); !ok && !d.NewValueKnown("datastore_id") {
+		log.Printf("[DEBUG] datastore_id is not known yet, skipping preflight")
+		return nil
+	}
+
+	p, err := resolvePlacement(ctx, client, d)
+	if err != nil {
+		return err
+	}
+
+	if err := checkCompatibility(d, client, p, desc); err != nil {
+		return fmt.Errorf("preflight: %s", err)
+	}
+
+	cisp, err := createImportSpecParams(ctx, d, desc.Envelope, client, p.datacenter)
+	if err != nil {
+		return err
+	}
+
+	ovfManager := ovf.NewManager(client.Client)
+	spec, err := ovfManager.CreateImportSpec(ctx, desc.Content, p.pool, p.datastore, cisp)
+	if err != nil {
+		return fmt.Errorf("preflight: %s", err)
+	}
+	faults := spec.Error
+	warnings := spec.Warning
+
+	host := p.host
+	if host == nil && p.cluster != nil {
+		networks := make([]types.ManagedObjectReference, len(cisp.NetworkMapping))
+		for i, n := range cisp.NetworkMapping {
+			networks[i] = n.Network
+		}
+		configs, err := diskConfigs(client, d)
+		if err != nil {
+			return fmt.Errorf("preflight: %s", err)
+		}
+		if host, err = computecluster.SelectHost(ctx, client, p.cluster, diskDatastores(p.datastore, configs), networks); err != nil {
+			return fmt.Errorf("preflight: %s", err)
+		}
+	}
+	if host != nil {
+		vhp := types.OvfValidateHostParams{OvfManagerCommonParams: cisp.OvfManagerCommonParams}
+		result, err := ovfManager.ValidateHost(ctx, desc.Content, host, vhp)
+		if err != nil {
+			return fmt.Errorf("preflight: %s", err)
+		}
+		faults = append(faults, result.Error...)
+		warnings = append(warnings, result.Warning...)
+	}
+
+	if err := importSpecError(faults); err != nil {
+		return fmt.Errorf("preflight: %s", err)
+	}
+	return d.SetNew("import_warnings", importSpecWarnings(warnings))
+}
+
+// preflightKeys have to be known to create an import spec during plan.
+// datacenter_id and host_system_id are computed by the import and unknown at
+// plan time unless configured, they are left out: the datacenter is derived
+// from the placement and the host is picked from the cluster instead.
+var preflightKeys = []string{
+	"name", "datastore_cluster_id", "cluster_id",
+	"default_network", "default_network_id", "disk_provisioning", "allow_hw_downgrade",
+}
+
+// diffUUID derives the UUID of a new template from the vCenter, the datacenter
+// the template is placed in, its folder and its name when no UUID is
+// configured, so that the UUID is known at plan time and stays the same
+// across plans. Templates with the same name in other datacenters or vCenters
+// get other UUIDs.
+func diffUUID(d *schema.ResourceDiff, client *govmomi.Client) error {
+	if d.Id() != "" || d.Get("uuid").(string) != "" {
+		return nil
+	}
+
+	for _, k := range []string{"name", "folder", "cluster_id", "datastore_cluster_id"} {
+		if !d.NewValueKnown(k) {
+			return nil
+		}
+	}
+
+	// datacenter_id, resource_pool_id and datastore_id are computed by the
+	// import and unknown at plan time unless configured, unknown values are
+	// left out. The datacenter is derived from the placement attributes that
+	// are known, any other one has to match it during apply anyway.
+	var refs []types.ManagedObjectReference
+	for _, k := range placementRefKeys {
+		if v, ok := d.GetOk(k.key); ok {
+			refs = append(refs, types.ManagedObjectReference{Type: k.refType, Value: v.(string)})
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	dc, err := placementDatacenter(client, d.Get("datacenter_id").(string), refs...)
+	if err != nil {
+		return err
+	}
+
+	return d.SetNew("uuid", nameBasedUUID(
+		client.ServiceContent.About.InstanceUuid, dc.Reference().Value, d.Get("folder").(string), d.Get("name").(string)))
+}
+
+// placementRefKeys are the placement attributes the datacenter of a new
+// template is derived from, with the type of the object they refer to.
+var placementRefKeys = []struct {
+	key     string
+	refType string
+}{
+	{"resource_pool_id", "ResourcePool"},
+	{"cluster_id", "ClusterComputeResource"},
+	{"datastore_id", "Datastore"},
+	{"datastore_cluster_id", "StoragePod"},
+}
+
+// checkUUIDUnused fails if a virtual machine in any datacenter already has the
+// UUID, since vSphere would assign the template another one.
+func checkUUIDUnused(client *govmomi.Client, uuid string) error {
+	if uuid == "" {
+		return nil
+	}
+	vm, err := virtualmachine.FromUUID(client, nil, uuid)
+	if err != nil {
+		return fmt.Errorf("error looking up UUID %q: %s", uuid, err)
+	}
+	if vm != nil {
+		return fmt.Errorf("UUID %q is already used by virtual machine %q", uuid, vm.InventoryPath)
+	}
+	return nil
+}
+
+// templateDatacenter returns the datacenter of the template, to scope UUID
+// lookups to it. States without datacenter_id are not scoped.
+func templateDatacenter(client *govmomi.Client, d resourceGetter) (*object.Datacenter, error) {
+	id := d.Get("datacenter_id").(string)
+	if id == "" {
+		return nil, nil
+	}
+	dc, err := datacenter.FromIDOrDefault(client, id)
+	if err != nil {
+		return nil, fmt.Errorf("error locating datacenter %q: %s", id, err)
+	}
+	return dc, nil
+}
+
+// uuidNamespace is hashed along with the name parts of name based UUIDs.
+const uuidNamespace = "vspheretemplate_ova_template"
+
+// nameBasedUUID returns a version 5 style UUID computed from the sha1 sum of
+// the given parts.
+func nameBasedUUID(parts ...string) string {
+	sum := sha1.Sum([]byte(uuidNamespace + "/" + strings.Join(parts, "/")))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func validateUUID(v interface{}, k string) ([]string, []error) {
+	if !uuidPattern.MatchString(v.(string)) {
+		return nil, []error{fmt.Errorf("%q must be a UUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, got %q", k, v)}
+	}
+	return nil, nil
+}
+
+// normalizeUUID lower-cases a configured UUID the way vSphere reports it, so
+// that a UUID in upper case does not plan a replacement.
+func normalizeUUID(v interface{}) string {
+	return strings.ToLower(v.(string))
+}
+
+// diffInaccessible replaces templates flagged as unusable by Read, so the
+// next apply imports the ova again.
+func diffInaccessible(d *schema.ResourceDiff) error {
+	if d.Id() == "" || !d.Get("inaccessible").(bool) {
+		return nil
+	}
+
+	if err := d.SetNew("inaccessible", false); err != nil {
+		return err
+	}
+	return d.ForceNew("inaccessible")
+}
+
+// diffOvaChecksum forces a new template when the contents of a local ova file
+// changed, even if ova_file_path stayed the same.
+func diffOvaChecksum(d *schema.ResourceDiff) error {
+	ovaPath := d.Get("ova_file_path").(string)
+	if ovaPath == "" || archive.IsRemotePath(ovaPath) {
+		return nil
+	}
+
+	cached := ovaChecksumFromState(d)
+	if d.HasChange("ova_file_path") {
+		cached = archive.Checksum{}
+	}
+
+	sum, err := archive.LocalChecksum(ovaPath, cached)
+	if os.IsNotExist(err) && d.Id() != "" && !d.HasChange("ova_file_path") {
+		// the ova is often cleaned up after the import, the template is
+		// still in use.
+		log.Printf("[DEBUG] %q: %q does not exist anymore, keeping the template", d.Id(), ovaPath)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error computing checksum of %q: %s", ovaPath, err)
+	}
+
+	oldSum := d.Get("ova_sha256").(string)
+	if d.Id() != "" && sum.Sum == oldSum {
+		return nil
+	}
+
+	if err := d.SetNew("ova_sha256", sum.Sum); err != nil {
+		return err
+	}
+	if err := d.SetNew("ova_file_size", int(sum.Size)); err != nil {
+		return err
+	}
+	if err := d.SetNew("ova_file_mtime", sum.ModTime); err != nil {
+		return err
+	}
+
+	if d.Id() != "" && oldSum != "" {
+		return d.ForceNew("ova_sha256")
+	}
+	return nil
+}
+
+type resourceGetter interface {
+	Get(string) interface{}
+	GetOk(string) (interface{}, bool)
+}
+
+func ovaChecksumFromState(d resourceGetter) archive.Checksum {
+	return archive.Checksum{
+		Sum:     d.Get("ova_sha256").(string),
+		Size:    int64(d.Get("ova_file_size").(int)),
+		ModTime: d.Get("ova_file_mtime").(string),
+	}
+}
+
+// refreshOvaChecksum updates the cached size and modification time of the ova
+// file in the state, as long as its contents did not change. Changed contents
+// are left for the diff to pick up.
+func refreshOvaChecksum(d *schema.ResourceData) {
+	ovaPath := d.Get("ova_file_path").(string)
+	cached := ovaChecksumFromState(d)
+	if ovaPath == "" || archive.IsRemotePath(ovaPath) || cached.Sum == "" {
+		return
+	}
+
+	sum, err := archive.LocalChecksum(ovaPath, cached)
+	if err != nil {
+		log.Printf("[DEBUG] %q: cannot refresh checksum of %q: %s", d.Id(), ovaPath, err)
+		return
+	}
+
+	if sum.Sum == cached.Sum {
+		d.Set("ova_file_size", int(sum.Size))
+		d.Set("ova_file_mtime", sum.ModTime)
+	}
+}
+
+func resourceVspheretemplateOvaTemplateUpdate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(*VSphereClient)
+	client := meta.vimClient
+
+	ctx, cancel := context.WithTimeout(meta.stopCtx, defaultAPITimeout)
+	defer cancel()
+
+	dc, err := templateDatacenter(client, d)
+	if err != nil {
+		return err
+	}
+	for _, uuid := range virtualSystemUUIDs(d, d.Id()) {
+		if err := updateVirtualMachine(ctx, client, d, dc, uuid); err != nil {
+			return err
+		}
+	}
+
+	return resourceVspheretemplateOvaTemplateRead(d, m)
+}
+
+// updateVirtualMachine applies the annotation, storage policies, sizing,
+// hardware version, extra_config, vapp and template attributes to one of the
+// imported virtual machines. A template that fails to be changed is marked as
+// template again.
+func updateVirtualMachine(ctx context.Context, client *govmomi.Client, d *schema.ResourceData, dc *object.Datacenter, id string) (err error) {
+	vm, err := virtualmachine.FromUUID(client, dc, id)
+	if err != nil || vm == nil {
+		return fmt.Errorf("cannot locate virtual machine with UUID %q", id)
+	}
+
+	props, err := virtualmachine.Properties(vm)
+	if err != nil {
+		return fmt.Errorf("error fetching virtual machine properties: %s", err)
+	}
+	if props.Config == nil {
+		return fmt.Errorf("no configuration returned for virtual machine %q", vm.InventoryPath)
+	}
+
+	spec := types.VirtualMachineConfigSpec{}
+	reconfigure := false
+	if d.HasChange("annotation") {
+		spec.Annotation = d.Get("annotation").(string)
+		reconfigure = true
+	}
+	if d.HasChange("storage_policy_id") {
+		spec.VmProfile = storagepolicy.ProfileSpec(d.Get("storage_policy_id").(string))
+		reconfigure = true
+	}
+	if sizingSpec(d, props, &spec) {
+		reconfigure = true
+	}
+	if extraConfigSpec(d, props, &spec) {
+		reconfigure = true
+	}
+	if vAppSpec(d, props, &spec) {
+		reconfigure = true
+	}
+	changes, err := diskChanges(d, props, id == d.Id())
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		spec.DeviceChange = changes
+		reconfigure = true
+	}
+	upgrade := hardwareUpgradeNeeded(d, props)
+
+	// templates cannot be reconfigured or upgraded, so a template always has
+	// to be turned back into a virtual machine first.
+	isTemplate := props.Config.Template
+	if isTemplate && (reconfigure || upgrade || !d.Get("template").(bool)) {
+		log.Printf("[INFO] Marking template as VM...\n")
+		if err := markAsVirtualMachine(ctx, client, d, vm); err != nil {
+			return err
+		}
+		isTemplate = false
+
+		// a template that cannot be changed must not be left behind as a
+		// virtual machine, which can be powered on and changed by accident.
+		defer func() {
+			if err == nil {
+				return
+			}
+			log.Printf("[INFO] Marking VM as template again...\n")
+			if terr := vm.MarkAsTemplate(ctx); terr != nil {
+				err = multierror.Append(err, fmt.Errorf("error marking %q as template again: %s", vm.InventoryPath, terr))
+			}
+		}()
+	}
+
+	if err := upgradeHardware(ctx, d, vm, props); err != nil {
+		return err
+	}
+	if reconfigure {
+		if err := virtualmachine.Reconfigure(ctx, vm, spec); err != nil {
+			return fmt.Errorf("error reconfiguring virtual machine %q: %s", vm.InventoryPath, err)
+		}
+	}
+
+	// vCenter rejects marking a template as template again.
+	if d.Get("template").(bool) && !isTemplate {
+		log.Printf("[INFO] Marking VM as template...\n")
+		if err := vm.MarkAsTemplate(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func markAsVirtualMachine(ctx context.Context, client *govmomi.Client, d *schema.ResourceData, vm *object.VirtualMachine) error {
+	poolID := d.Get("resource_pool_id").(string)
+	pool, err := resourcepool.FromID(client, poolID)
+	if err != nil {
+		return fmt.Errorf("could not find resource pool ID %q: %s", poolID, err)
+	}
+
+	var hs *object.HostSystem
+	if v, ok := d.GetOk("host_system_id"); ok {
+		hsID := v.(string)
+		if hs, err = hostsystem.FromID(client, hsID); err != nil {
+			return fmt.Errorf("error locating host system at ID %q: %s", hsID, err)
+		}
+	}
+
+	return vm.MarkAsVirtualMachine(ctx, *pool, hs)
+}
+
+func resourceVspheretemplateOvaTemplateDelete(d *schema.ResourceData, m interface{}) error {
+	meta := m.(*VSphereClient)
+	client := meta.vimClient
+
+	ctx, cancel := context.WithTimeout(meta.stopCtx, d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
+	id := d.Id()
+
+	// destroying a vApp destroys its virtual machines as well.
+	if v, ok := d.GetOk("vapp_id"); ok {
+		ref := types.ManagedObjectReference{Type: "VirtualApp", Value: v.(string)}
+		if err := destroyEntity(ctx, client, ref); err != nil {
+			return fmt.Errorf("error destroying vApp %q: %s", ref.Value, err)
+		}
+		d.SetId("")
+		log.Printf("[DEBUG] %q: Delete complete", id)
+		return nil
+	}
+
+	dc, err := templateDatacenter(client, d)
+	if err != nil {
+		return err
+	}
+	for i, uuid := range virtualSystemUUIDs(d, id) {
+		if err := deleteVirtualMachine(ctx, client, dc, uuid, i > 0); err != nil {
+			return err
+		}
+	}
+
+	d.SetId("")
+	log.Printf("[DEBUG] %q: Delete complete", id)
+	return nil
+}
+
+// deleteVirtualMachine destroys one of the imported virtual machines. A
+// missing virtual machine is an error unless ignoreMissing is set.
+func deleteVirtualMachine(ctx context.Context, client *govmomi.Client, dc *object.Datacenter, id string, ignoreMissing bool) error {
+	vm, err := virtualmachine.FromUUID(client, dc, id)
+	if err == nil && vm == nil && ignoreMissing {
+		log.Printf("[DEBUG] %q: virtual machine not found, skipping", id)
+		return nil
+	}
+	if err != nil || vm == nil {
+		return fmt.Errorf("cannot locate virtual machine with UUID %q", id)
+	}
+
+	props, err := virtualmachine.Properties(vm)
+	if err != nil {
+		return fmt.Errorf("error fetching virtual machine properties: %s", err)
+	}
+
+	// the files of an unusable template cannot be deleted, only drop it from
+	// the inventory.
+	if usable, reason := virtualmachine.Usable(props); !usable {
+		log.Printf("[WARN] %q: %s, unregistering", id, reason)
+		return vm.Unregister(ctx)
+	}
+
+	task, err := vm.Destroy(ctx)
+	if err != nil {
+		return err
+	}
+
+	return task.Wait(ctx)
 }
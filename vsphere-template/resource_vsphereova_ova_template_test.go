@@ -0,0 +1,726 @@
+package vsphere_template
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testInstanceUUID is the instance UUID of the fake vCenter.
+const testInstanceUUID = "5f6e1dc4-3a83-4a8e-a1b6-4d5c9e8f7a01"
+
+// fakeEntity is a managed entity of the fake vCenter.
+type fakeEntity struct {
+	ref    types.ManagedObjectReference
+	name   string
+	parent string
+}
+
+// fakeVSphere answers property collector requests for the names and parents
+// of its entities, which is enough to locate datacenters and inventory paths.
+// Any other request fails.
+type fakeVSphere map[string]fakeEntity
+
+func newFakeVSphere() fakeVSphere {
+	f := fakeVSphere{}
+	for _, e := range []fakeEntity{
+		{types.ManagedObjectReference{Type: "Folder", Value: "group-d1"}, "Datacenters", ""},
+		{types.ManagedObjectReference{Type: "Datacenter", Value: "datacenter-2"}, "dc1", "group-d1"},
+		{types.ManagedObjectReference{Type: "Folder", Value: "group-h4"}, "host", "datacenter-2"},
+		{types.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c7"}, "cluster1", "group-h4"},
+		{types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-8"}, "Resources", "domain-c7"},
+		{types.ManagedObjectReference{Type: "Folder", Value: "group-s5"}, "datastore", "datacenter-2"},
+		{types.ManagedObjectReference{Type: "Datastore", Value: "datastore-10"}, "ds1", "group-s5"},
+		{types.ManagedObjectReference{Type: "StoragePod", Value: "group-p11"}, "pod1", "group-s5"},
+		{types.ManagedObjectReference{Type: "Folder", Value: "group-v3"}, "vm", "datacenter-2"},
+		{types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-30"}, "template", "group-v3"},
+		{types.ManagedObjectReference{Type: "Datacenter", Value: "datacenter-21"}, "dc2", "group-d1"},
+		{types.ManagedObjectReference{Type: "Folder", Value: "group-h23"}, "host", "datacenter-21"},
+		{types.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c27"}, "cluster2", "group-h23"},
+		{types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-28"}, "Resources", "domain-c27"},
+	} {
+		f[e.ref.Value] = e
+	}
+	return f
+}
+
+func (f fakeVSphere) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	body, ok := req.(*methods.RetrievePropertiesBody)
+	if !ok {
+		return fmt.Errorf("fake vSphere: %T is not implemented", req)
+	}
+
+	var objects []types.ObjectContent
+	for _, spec := range body.Req.SpecSet {
+		for _, o := range spec.ObjectSet {
+			// a select set asks for the ancestors of the object as well.
+			for id := o.Obj.Value; id != ""; id = f[id].parent {
+				e, ok := f[id]
+				if !ok {
+					return fmt.Errorf("fake vSphere: %s %q does not exist", o.Obj.Type, id)
+				}
+				content, err := f.content(e, spec.PropSet)
+				if err != nil {
+					return err
+				}
+				objects = append(objects, content)
+				if len(o.SelectSet) == 0 {
+					break
+				}
+			}
+		}
+	}
+
+	res.(*methods.RetrievePropertiesBody).Res = &types.RetrievePropertiesResponse{Returnval: objects}
+	return nil
+}
+
+func (f fakeVSphere) content(e fakeEntity, props []types.PropertySpec) (types.ObjectContent, error) {
+	content := types.ObjectContent{Obj: e.ref}
+	for _, p := range props {
+		for _, name := range p.PathSet {
+			switch name {
+			case "name":
+				content.PropSet = append(content.PropSet, types.DynamicProperty{Name: name, Val: e.name})
+			case "parent":
+				if e.parent != "" {
+					content.PropSet = append(content.PropSet, types.DynamicProperty{Name: name, Val: f[e.parent].ref})
+				}
+			case "parentVApp":
+			default:
+				return content, fmt.Errorf("fake vSphere: property %q of %s is not implemented", name, e.ref.Type)
+			}
+		}
+	}
+	return content, nil
+}
+
+// fakeTemplate is a fake vCenter holding the virtual machine vm-30. It records
+// the calls that change the virtual machine, and fails the ones in fail.
+type fakeTemplate struct {
+	fakeVSphere
+	config types.VirtualMachineConfigInfo
+	fail   map[string]bool
+	calls  []string
+}
+
+func (f *fakeTemplate) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	vm := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-30"}
+	task := types.ManagedObjectReference{Type: "Task", Value: "task-1"}
+
+	var call string
+	switch body := res.(type) {
+	case *methods.FindByUuidBody:
+		body.Res = &types.FindByUuidResponse{Returnval: &vm}
+		return nil
+	case *methods.RetrievePropertiesBody:
+		spec := req.(*methods.RetrievePropertiesBody).Req.SpecSet[0]
+		if spec.ObjectSet[0].Obj != vm || spec.PropSet[0].All == nil || !*spec.PropSet[0].All {
+			return f.fakeVSphere.RoundTrip(ctx, req, res)
+		}
+		body.Res = &types.RetrievePropertiesResponse{Returnval: []types.ObjectContent{{
+			Obj:     vm,
+			PropSet: []types.DynamicProperty{{Name: "config", Val: f.config}},
+		}}}
+		return nil
+	case *methods.CreatePropertyCollectorBody:
+		body.Res = &types.CreatePropertyCollectorResponse{Returnval: types.ManagedObjectReference{Type: "PropertyCollector", Value: "session"}}
+		return nil
+	case *methods.CreateFilterBody:
+		body.Res = &types.CreateFilterResponse{Returnval: types.ManagedObjectReference{Type: "PropertyFilter", Value: "filter"}}
+		return nil
+	case *methods.WaitForUpdatesExBody:
+		// every task succeeds right away.
+		body.Res = &types.WaitForUpdatesExResponse{Returnval: &types.UpdateSet{
+			Version: "1",
+			FilterSet: []types.PropertyFilterUpdate{{ObjectSet: []types.ObjectUpdate{{
+				Obj:       task,
+				ChangeSet: []types.PropertyChange{{Name: "info", Op: types.PropertyChangeOpAssign, Val: types.TaskInfo{State: types.TaskInfoStateSuccess}}},
+			}}}},
+		}}
+		return nil
+	case *methods.DestroyPropertyCollectorBody:
+		body.Res = &types.DestroyPropertyCollectorResponse{}
+		return nil
+	case *methods.MarkAsVirtualMachineBody:
+		call = "MarkAsVirtualMachine"
+		body.Res = &types.MarkAsVirtualMachineResponse{}
+	case *methods.MarkAsTemplateBody:
+		call = "MarkAsTemplate"
+		body.Res = &types.MarkAsTemplateResponse{}
+	case *methods.ReconfigVM_TaskBody:
+		call = "ReconfigVM_Task"
+		body.Res = &types.ReconfigVM_TaskResponse{Returnval: task}
+	case *methods.UpgradeVM_TaskBody:
+		call = "UpgradeVM_Task"
+		body.Res = &types.UpgradeVM_TaskResponse{Returnval: task}
+	default:
+		return f.fakeVSphere.RoundTrip(ctx, req, res)
+	}
+
+	f.calls = append(f.calls, call)
+	if f.fail[call] {
+		return fmt.Errorf("fake vSphere: %s failed", call)
+	}
+	switch call {
+	case "MarkAsVirtualMachine":
+		f.config.Template = false
+	case "MarkAsTemplate":
+		f.config.Template = true
+	}
+	return nil
+}
+
+func testMeta() *VSphereClient {
+	return &VSphereClient{
+		vimClient: &govmomi.Client{
+			Client: &vim25.Client{
+				ServiceContent: types.ServiceContent{
+					RootFolder:        types.ManagedObjectReference{Type: "Folder", Value: "group-d1"},
+					PropertyCollector: types.ManagedObjectReference{Type: "PropertyCollector", Value: "propertyCollector"},
+					SearchIndex:       &types.ManagedObjectReference{Type: "SearchIndex", Value: "SearchIndex"},
+					About:             types.AboutInfo{InstanceUuid: testInstanceUUID},
+				},
+				RoundTripper: newFakeVSphere(),
+			},
+		},
+		stopCtx: context.Background(),
+	}
+}
+
+// unknown is an interpolation that is only known during apply.
+const unknown = "${var.unknown}"
+
+func testResourceConfig(t *testing.T, raw map[string]interface{}) *terraform.ResourceConfig {
+	rc := config.TestRawConfig(t, raw)
+	err := rc.Interpolate(map[string]ast.Variable{
+		"var.unknown": {Value: config.UnknownVariableValue, Type: ast.TypeUnknown},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return terraform.NewResourceConfig(rc)
+}
+
+func TestDiffUUID(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		dc     string
+		err    string
+	}{
+		{
+			name:   "resource pool and datastore",
+			config: map[string]interface{}{"resource_pool_id": "resgroup-8", "datastore_id": "datastore-10"},
+			dc:     "datacenter-2",
+		},
+		{
+			name:   "cluster",
+			config: map[string]interface{}{"cluster_id": "domain-c7", "datastore_id": "datastore-10"},
+			dc:     "datacenter-2",
+		},
+		{
+			name:   "datastore cluster",
+			config: map[string]interface{}{"resource_pool_id": "resgroup-8", "datastore_cluster_id": "group-p11"},
+			dc:     "datacenter-2",
+		},
+		{
+			name:   "cluster and datastore cluster",
+			config: map[string]interface{}{"cluster_id": "domain-c7", "datastore_cluster_id": "group-p11"},
+			dc:     "datacenter-2",
+		},
+		{
+			name:   "matching datacenter",
+			config: map[string]interface{}{"cluster_id": "domain-c7", "datastore_id": "datastore-10", "datacenter_id": "datacenter-2"},
+			dc:     "datacenter-2",
+		},
+		{
+			name:   "unknown datacenter",
+			config: map[string]interface{}{"cluster_id": "domain-c7", "datastore_id": "datastore-10", "datacenter_id": unknown},
+			dc:     "datacenter-2",
+		},
+		{
+			name:   "unknown resource pool",
+			config: map[string]interface{}{"resource_pool_id": unknown, "datastore_id": "datastore-10"},
+			dc:     "datacenter-2",
+		},
+		{
+			name:   "other datacenter",
+			config: map[string]interface{}{"cluster_id": "domain-c27", "datastore_id": "datastore-10"},
+			err:    "is in datacenter",
+		},
+		{
+			name:   "contradicting datacenter",
+			config: map[string]interface{}{"cluster_id": "domain-c7", "datastore_id": "datastore-10", "datacenter_id": "datacenter-21"},
+			err:    "does not match datacenter",
+		},
+		{
+			name:   "unknown cluster",
+			config: map[string]interface{}{"cluster_id": unknown, "datastore_id": "datastore-10"},
+		},
+		{
+			name:   "unknown placement",
+			config: map[string]interface{}{"resource_pool_id": unknown, "datastore_id": unknown},
+		},
+		{
+			name:   "unknown name",
+			config: map[string]interface{}{"name": unknown, "cluster_id": "domain-c7", "datastore_id": "datastore-10"},
+		},
+	}
+
+	for _, c := range cases {
+		raw := map[string]interface{}{
+			"name":          "template",
+			"folder":        "templates",
+			"ova_file_path": unknown,
+		}
+		for k, v := range c.config {
+			raw[k] = v
+		}
+
+		diff, err := resourceVspheretemplateOvaTemplate().Diff(nil, testResourceConfig(t, raw), testMeta())
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+
+		attr := diff.Attributes["uuid"]
+		if c.dc == "" {
+			if attr == nil || !attr.NewComputed {
+				t.Errorf("%s: expected uuid to be computed, got %#v", c.name, attr)
+			}
+			continue
+		}
+		want := nameBasedUUID(testInstanceUUID, c.dc, "templates", raw["name"].(string))
+		if attr == nil || attr.NewComputed || attr.New != want {
+			t.Errorf("%s: expected uuid %q to be planned, got %#v", c.name, want, attr)
+		}
+	}
+}
+
+// testTemplateState returns the state of an imported template whose ova file
+// was removed after the import, with the given attributes on top.
+func testTemplateState(attrs map[string]string) *terraform.InstanceState {
+	state := &terraform.InstanceState{
+		ID: "4216a2f1-5d0b-4c1e-9f3a-0b1c2d3e4f50",
+		Attributes: map[string]string{
+			"id":                       "4216a2f1-5d0b-4c1e-9f3a-0b1c2d3e4f50",
+			"uuid":                     "4216a2f1-5d0b-4c1e-9f3a-0b1c2d3e4f50",
+			"name":                     "template",
+			"folder":                   "templates",
+			"datacenter_id":            "datacenter-2",
+			"resource_pool_id":         "resgroup-8",
+			"datastore_id":             "datastore-10",
+			"ova_file_path":            "/nonexistent/template.ova",
+			"ova_sha256":               "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			"ova_file_size":            "1024",
+			"template":                 "true",
+			"recreate_if_inaccessible": "true",
+			"accept_eula":              "false",
+			"descriptor_fixups":        "false",
+			"allow_hw_downgrade":       "false",
+			"virtual_system_mode":      "templates",
+			"preflight":                "false",
+		},
+	}
+	for k, v := range attrs {
+		state.Attributes[k] = v
+	}
+	return state
+}
+
+// testTemplateConfig returns the configuration of the template of
+// testTemplateState, with the given attributes on top.
+func testTemplateConfig(t *testing.T, config map[string]interface{}) *terraform.ResourceConfig {
+	raw := map[string]interface{}{
+		"name":             "template",
+		"folder":           "templates",
+		"resource_pool_id": "resgroup-8",
+		"datastore_id":     "datastore-10",
+		"ova_file_path":    "/nonexistent/template.ova",
+	}
+	for k, v := range config {
+		raw[k] = v
+	}
+	return testResourceConfig(t, raw)
+}
+
+// testTemplateData returns the resource data of an update of the template in
+// state to the configuration.
+func testTemplateData(t *testing.T, state *terraform.InstanceState, config *terraform.ResourceConfig) *schema.ResourceData {
+	r := resourceVspheretemplateOvaTemplate()
+	diff, err := r.Diff(state, config, testMeta())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data *schema.ResourceData
+	r.Update = func(d *schema.ResourceData, m interface{}) error {
+		data = d
+		return nil
+	}
+	if _, err := r.Apply(state, diff, testMeta()); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDiffExistingTemplate(t *testing.T) {
+	state := testTemplateState(nil)
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "removed ova file",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "upper case uuid",
+			config: map[string]interface{}{"uuid": "4216A2F1-5D0B-4C1E-9F3A-0B1C2D3E4F50"},
+		},
+		{
+			// the replacement imports the ova file again.
+			name:   "other uuid",
+			config: map[string]interface{}{"uuid": "4216a2f1-5d0b-4c1e-9f3a-0b1c2d3e4f51"},
+			err:    "error computing checksum",
+		},
+		{
+			name:   "other ova file",
+			config: map[string]interface{}{"ova_file_path": "/nonexistent/other.ova"},
+			err:    "error computing checksum",
+		},
+	}
+
+	for _, c := range cases {
+		diff, err := resourceVspheretemplateOvaTemplate().Diff(state, testTemplateConfig(t, c.config), testMeta())
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if diff != nil && diff.RequiresNew() {
+			t.Errorf("%s: expected the template to be kept, got %#v", c.name, diff)
+		}
+	}
+}
+
+// testOvf is a minimal ovf with a single virtual system.
+const testOvf = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData">
+  <VirtualSystem ovf:id="appliance">
+    <Info>A virtual machine</Info>
+    <Name>appliance</Name>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemType>vmx-13</vssd:VirtualSystemType>
+      </System>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>`
+
+// writeTestOva writes an ova with the ovf to a temporary directory and returns
+// its path.
+func writeTestOva(t *testing.T, dir, ovf string) string {
+	path := filepath.Join(dir, "template.ova")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := tar.NewWriter(f)
+	if err := w.WriteHeader(&tar.Header{Name: "template.ovf", Mode: 0644, Size: int64(len(ovf))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(ovf)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiffPreflight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preflight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ovaPath := writeTestOva(t, dir, testOvf)
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "resource pool and datastore",
+			config: map[string]interface{}{"resource_pool_id": "resgroup-8", "datastore_id": "datastore-10"},
+			err:    "preflight:",
+		},
+		{
+			name:   "unknown datacenter and host",
+			config: map[string]interface{}{"resource_pool_id": "resgroup-8", "datastore_id": "datastore-10", "datacenter_id": unknown, "host_system_id": unknown},
+			err:    "preflight:",
+		},
+		{
+			name:   "unknown resource pool",
+			config: map[string]interface{}{"resource_pool_id": unknown, "datastore_id": "datastore-10"},
+		},
+		{
+			name:   "unknown cluster",
+			config: map[string]interface{}{"cluster_id": unknown, "datastore_id": "datastore-10"},
+		},
+	}
+
+	for _, c := range cases {
+		raw := map[string]interface{}{
+			"name":          "template",
+			"folder":        "templates",
+			"ova_file_path": ovaPath,
+			"preflight":     true,
+		}
+		for k, v := range c.config {
+			raw[k] = v
+		}
+
+		// the fake vCenter does not implement the environment browser, an
+		// error from it shows that the preflight ran.
+		_, err := resourceVspheretemplateOvaTemplate().Diff(nil, testResourceConfig(t, raw), testMeta())
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected the preflight to be skipped, got: %s", c.name, err)
+		}
+	}
+}
+
+func TestUpdateVirtualMachine(t *testing.T) {
+	cases := []struct {
+		name     string
+		template bool
+		config   map[string]interface{}
+		fail     string
+		calls    []string
+		err      string
+	}{
+		{
+			name:     "unchanged template",
+			template: true,
+		},
+		{
+			name:     "resize template",
+			template: true,
+			config:   map[string]interface{}{"num_cpus": 4},
+			calls:    []string{"MarkAsVirtualMachine", "ReconfigVM_Task", "MarkAsTemplate"},
+		},
+		{
+			name:     "upgrade template",
+			template: true,
+			config:   map[string]interface{}{"hardware_version": "vmx-14"},
+			calls:    []string{"MarkAsVirtualMachine", "UpgradeVM_Task", "MarkAsTemplate"},
+		},
+		{
+			name:     "template to virtual machine",
+			template: true,
+			config:   map[string]interface{}{"template": false},
+			calls:    []string{"MarkAsVirtualMachine"},
+		},
+		{
+			name:     "virtual machine to template",
+			template: false,
+			config:   map[string]interface{}{"template": true},
+			calls:    []string{"MarkAsTemplate"},
+		},
+		{
+			name:     "resize virtual machine",
+			template: false,
+			config:   map[string]interface{}{"template": false, "num_cpus": 4},
+			calls:    []string{"ReconfigVM_Task"},
+		},
+		{
+			name:     "failed reconfiguration",
+			template: true,
+			config:   map[string]interface{}{"num_cpus": 4},
+			fail:     "ReconfigVM_Task",
+			calls:    []string{"MarkAsVirtualMachine", "ReconfigVM_Task", "MarkAsTemplate"},
+			err:      "error reconfiguring virtual machine",
+		},
+		{
+			name:     "failed upgrade",
+			template: true,
+			config:   map[string]interface{}{"hardware_version": "vmx-14"},
+			fail:     "UpgradeVM_Task",
+			calls:    []string{"MarkAsVirtualMachine", "UpgradeVM_Task", "MarkAsTemplate"},
+			err:      "error upgrading virtual hardware",
+		},
+		{
+			name:     "failed reconfiguration to virtual machine",
+			template: true,
+			config:   map[string]interface{}{"template": false, "num_cpus": 4},
+			fail:     "ReconfigVM_Task",
+			calls:    []string{"MarkAsVirtualMachine", "ReconfigVM_Task", "MarkAsTemplate"},
+			err:      "error reconfiguring virtual machine",
+		},
+		{
+			name:     "failed reconfiguration of virtual machine",
+			template: false,
+			config:   map[string]interface{}{"template": false, "num_cpus": 4},
+			fail:     "ReconfigVM_Task",
+			calls:    []string{"ReconfigVM_Task"},
+			err:      "error reconfiguring virtual machine",
+		},
+	}
+
+	for _, c := range cases {
+		state := testTemplateState(map[string]string{
+			"template":         fmt.Sprint(c.template),
+			"num_cpus":         "2",
+			"hardware_version": "vmx-13",
+		})
+		d := testTemplateData(t, state, testTemplateConfig(t, c.config))
+
+		fake := &fakeTemplate{
+			fakeVSphere: newFakeVSphere(),
+			config: types.VirtualMachineConfigInfo{
+				Template: c.template,
+				Version:  "vmx-13",
+				Hardware: types.VirtualHardware{NumCPU: 2},
+			},
+			fail: map[string]bool{c.fail: true},
+		}
+		meta := testMeta()
+		meta.vimClient.Client.RoundTripper = fake
+		client := meta.vimClient
+		dc := object.NewDatacenter(client.Client, types.ManagedObjectReference{Type: "Datacenter", Value: "datacenter-2"})
+
+		err := updateVirtualMachine(context.Background(), client, d, dc, d.Id())
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		}
+		if !reflect.DeepEqual(fake.calls, c.calls) {
+			t.Errorf("%s: got calls %v, want %v", c.name, fake.calls, c.calls)
+		}
+		// a template stays a template if it cannot be changed.
+		want := d.Get("template").(bool)
+		if c.err != "" {
+			want = c.template
+		}
+		if fake.config.Template != want {
+			t.Errorf("%s: got template %t, want %t", c.name, fake.config.Template, want)
+		}
+	}
+}
+
+// testCollectionOvf is a minimal ovf with a collection of two virtual systems.
+const testCollectionOvf = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData">
+  <VirtualSystemCollection ovf:id="stack">
+    <Info>A collection of virtual machines</Info>
+    <VirtualSystem ovf:id="web">
+      <Info>The web server</Info>
+    </VirtualSystem>
+    <VirtualSystem ovf:id="db">
+      <Info>The database</Info>
+    </VirtualSystem>
+  </VirtualSystemCollection>
+</Envelope>`
+
+func TestDiffVirtualSystemMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ovaPath := writeTestOva(t, dir, testCollectionOvf)
+
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "templates on a datastore cluster",
+			config: map[string]interface{}{"datastore_cluster_id": "group-p11"},
+		},
+		{
+			name:   "vapp",
+			config: map[string]interface{}{"virtual_system_mode": "vapp", "template": false, "datastore_id": "datastore-10"},
+		},
+		{
+			name:   "vapp of templates",
+			config: map[string]interface{}{"virtual_system_mode": "vapp", "datastore_id": "datastore-10"},
+			err:    "virtual machines in a vApp cannot be templates",
+		},
+		{
+			name:   "vapp on a datastore cluster",
+			config: map[string]interface{}{"virtual_system_mode": "vapp", "template": false, "datastore_cluster_id": "group-p11"},
+			err:    "a vApp cannot be placed on a datastore cluster",
+		},
+	}
+
+	for _, c := range cases {
+		raw := map[string]interface{}{
+			"name":             "template",
+			"folder":           "templates",
+			"resource_pool_id": "resgroup-8",
+			"ova_file_path":    ovaPath,
+		}
+		for k, v := range c.config {
+			raw[k] = v
+		}
+
+		_, err := resourceVspheretemplateOvaTemplate().Diff(nil, testResourceConfig(t, raw), testMeta())
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		}
+	}
+}
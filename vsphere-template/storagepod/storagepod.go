@@ -0,0 +1,112 @@
+package storagepod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+)
+
+func FromID(client *govmomi.Client, id string) (*object.StoragePod, error) {
+	log.Printf("[DEBUG] Locating datastore cluster with ID %q", id)
+	finder := find.NewFinder(client.Client, false)
+
+	ref := types.ManagedObjectReference{
+		Type:  "StoragePod",
+		Value: id,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pod, err := finder.ObjectReference(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DEBUG] Datastore cluster with ID %q found", pod.Reference().Value)
+	return pod.(*object.StoragePod), nil
+}
+
+// AnyDatastore returns one of the datastores in the datastore cluster.
+func AnyDatastore(client *govmomi.Client, pod *object.StoragePod) (*object.Datastore, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var props mo.StoragePod
+	if err := pod.Properties(ctx, pod.Reference(), []string{"childEntity"}, &props); err != nil {
+		return nil, err
+	}
+
+	for _, ref := range props.ChildEntity {
+		if ref.Type == "Datastore" {
+			return object.NewDatastore(client.Client, ref), nil
+		}
+	}
+
+	return nil, fmt.Errorf("datastore cluster %q does not contain any datastore", pod.Reference().Value)
+}
+
+// RecommendDatastore asks Storage DRS for the datastore in the datastore
+// cluster to create a virtual machine with the given config on, and returns
+// the datastore of the first recommendation.
+func RecommendDatastore(
+	ctx context.Context,
+	client *govmomi.Client,
+	pod *object.StoragePod,
+	pool *object.ResourcePool,
+	host *object.HostSystem,
+	folder *object.Folder,
+	config types.VirtualMachineConfigSpec) (*object.Datastore, error) {
+	podRef := pod.Reference()
+	poolRef := pool.Reference()
+	folderRef := folder.Reference()
+
+	spec := types.StoragePlacementSpec{
+		Type:         string(types.StoragePlacementSpecPlacementTypeCreate),
+		ResourcePool: &poolRef,
+		Folder:       &folderRef,
+		ConfigSpec:   &config,
+		PodSelectionSpec: types.StorageDrsPodSelectionSpec{
+			StoragePod: &podRef,
+		},
+	}
+	if host != nil {
+		hostRef := host.Reference()
+		spec.Host = &hostRef
+	}
+
+	log.Printf("[DEBUG] Requesting Storage DRS recommendation for datastore cluster %q", podRef.Value)
+	result, err := object.NewStorageResourceManager(client.Client).RecommendDatastores(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range result.Recommendations {
+		for _, a := range r.Action {
+			if action, ok := a.(*types.StoragePlacementAction); ok {
+				log.Printf("[DEBUG] Storage DRS recommended datastore %q: %s", action.Destination.Value, r.Reason)
+				return object.NewDatastore(client.Client, action.Destination), nil
+			}
+		}
+	}
+
+	if result.DrsFault != nil {
+		return nil, drsFaultError(result.DrsFault)
+	}
+	return nil, errors.New("Storage DRS did not return any recommendation")
+}
+
+func drsFaultError(faults *types.ClusterDrsFaults) error {
+	var messages []string
+	for _, byVM := range faults.FaultsByVm {
+		for _, f := range byVM.GetClusterDrsFaultsFaultsByVm().Fault {
+			messages = append(messages, f.LocalizedMessage)
+		}
+	}
+	return fmt.Errorf("Storage DRS could not place the template: %v", messages)
+}
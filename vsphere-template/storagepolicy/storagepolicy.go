@@ -0,0 +1,80 @@
+package storagepolicy
+
+import (
+	"context"
+	"fmt"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/pbm"
+	"github.com/vmware/govmomi/pbm/methods"
+	pbmtypes "github.com/vmware/govmomi/pbm/types"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+)
+
+// NewClient connects to the storage policy service of the vCenter.
+func NewClient(ctx context.Context, client *govmomi.Client) (*pbm.Client, error) {
+	pc, err := pbm.NewClient(ctx, client.Client)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the storage policy service: %s", err)
+	}
+	return pc, nil
+}
+
+// Validate checks that a storage policy with the given ID exists.
+func Validate(ctx context.Context, pc *pbm.Client, id string) error {
+	log.Printf("[DEBUG] Locating storage policy ID %s", id)
+
+	profiles, err := pc.RetrieveContent(ctx, []pbmtypes.PbmProfileId{{UniqueId: id}})
+	if err != nil || len(profiles) == 0 {
+		return fmt.Errorf("could not find storage policy with id: %s: %v", id, err)
+	}
+
+	log.Printf("[DEBUG] Storage policy found: %s", profiles[0].GetPbmProfile().Name)
+	return nil
+}
+
+// ProfileSpec returns the profile spec assigning the storage policy with the
+// given ID, or the default policy of the datastore if id is empty.
+func ProfileSpec(id string) []types.BaseVirtualMachineProfileSpec {
+	if id == "" {
+		return []types.BaseVirtualMachineProfileSpec{&types.VirtualMachineDefaultProfileSpec{}}
+	}
+	return []types.BaseVirtualMachineProfileSpec{&types.VirtualMachineDefinedProfileSpec{ProfileId: id}}
+}
+
+// ForVirtualMachine returns the ID of the storage policy associated with the
+// home files of the virtual machine, or an empty string if there is none.
+func ForVirtualMachine(ctx context.Context, client *govmomi.Client, pc *pbm.Client, vm types.ManagedObjectReference) (string, error) {
+	return associatedPolicy(ctx, client, pc, pbmtypes.PbmServerObjectRef{
+		ObjectType: string(pbmtypes.PbmObjectTypeVirtualMachine),
+		Key:        vm.Value,
+	})
+}
+
+// ForVirtualDisk returns the ID of the storage policy associated with the disk
+// with the given device key, or an empty string if there is none.
+func ForVirtualDisk(ctx context.Context, client *govmomi.Client, pc *pbm.Client, vm types.ManagedObjectReference, key int32) (string, error) {
+	return associatedPolicy(ctx, client, pc, pbmtypes.PbmServerObjectRef{
+		ObjectType: string(pbmtypes.PbmObjectTypeVirtualDiskId),
+		Key:        fmt.Sprintf("%s:%d", vm.Value, key),
+	})
+}
+
+func associatedPolicy(ctx context.Context, client *govmomi.Client, pc *pbm.Client, ref pbmtypes.PbmServerObjectRef) (string, error) {
+	log.Printf("[DEBUG] Fetching storage policy of %s %q", ref.ObjectType, ref.Key)
+
+	ref.ServerUuid = client.ServiceContent.About.InstanceUuid
+	req := pbmtypes.PbmQueryAssociatedProfile{
+		This:   pc.ServiceContent.ProfileManager,
+		Entity: ref,
+	}
+	res, err := methods.PbmQueryAssociatedProfile(ctx, pc, &req)
+	if err != nil {
+		return "", err
+	}
+
+	if len(res.Returnval) == 0 {
+		return "", nil
+	}
+	return res.Returnval[0].UniqueId, nil
+}
@@ -0,0 +1,128 @@
+package vsphere_template
+
+import (
+	"fmt"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/descriptor"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/environmentbrowser"
+	"github.com/hashicorp/go-multierror"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+	"strings"
+)
+
+// checkCompatibility verifies that the virtual hardware versions and guest
+// OSes of the ovf are supported by the compute resource of the placement, and
+// by its host if one is set, and that so is hardware_version, if set. With
+// allow_hw_downgrade, the hardware version of every virtual system that
+// requires a version that is too new is replaced by the newest supported one
+// in the descriptor.
+func checkCompatibility(d resourceGetter, client *govmomi.Client, p *importPlacement, desc *descriptor.Descriptor) error {
+	browser, err := environmentbrowser.FromResourcePool(client, p.pool.Reference())
+	if err != nil {
+		return err
+	}
+
+	var host *types.ManagedObjectReference
+	target := "the compute resource of the resource pool"
+	if p.host != nil {
+		ref := p.host.Reference()
+		host = &ref
+		target = fmt.Sprintf("host %q", p.host.Name())
+	}
+
+	supported, err := environmentbrowser.HardwareVersions(client, browser, host)
+	if err != nil {
+		return fmt.Errorf("error querying supported hardware versions: %s", err)
+	}
+	if len(supported) == 0 {
+		log.Printf("[WARN] %s reports no supported hardware versions, skipping compatibility check", target)
+		return nil
+	}
+	newest := newestHardwareVersion(supported)
+
+	var result *multierror.Error
+	if v := d.Get("hardware_version").(string); v != "" && !containsString(supported, v) {
+		result = multierror.Append(result, fmt.Errorf(
+			"hardware_version %s is not supported by %s, which supports %s", v, target, strings.Join(supported, ", ")))
+	}
+	var downgrades []string
+	guestIDs := map[string][]string{}
+	for _, r := range desc.Requirements() {
+		version := newestHardwareVersion(intersect(r.HardwareVersions, supported))
+		if len(r.HardwareVersions) == 0 {
+			version = newest
+		}
+		if version == "" {
+			if !d.Get("allow_hw_downgrade").(bool) {
+				result = multierror.Append(result, fmt.Errorf(
+					"virtual system %q requires virtual hardware %s, but %s only supports %s; set allow_hw_downgrade = true to import it with %s",
+					r.System, strings.Join(r.HardwareVersions, " or "), target, strings.Join(supported, ", "), newest))
+				continue
+			}
+			log.Printf("[INFO] downgrading virtual hardware of virtual system %q from %s to %s", r.System, strings.Join(r.HardwareVersions, " or "), newest)
+			downgrades = append(downgrades, r.System)
+			version = newest
+		}
+
+		if r.GuestID == "" {
+			continue
+		}
+		if _, ok := guestIDs[version]; !ok {
+			ids, err := environmentbrowser.GuestIDs(client, browser, version, host)
+			if err != nil {
+				return fmt.Errorf("error querying supported guest OSes of %s: %s", version, err)
+			}
+			guestIDs[version] = ids
+		}
+		if !containsString(guestIDs[version], r.GuestID) {
+			result = multierror.Append(result, fmt.Errorf(
+				"virtual system %q has guest OS %q, which %s does not support with virtual hardware %s", r.System, r.GuestID, target, version))
+		}
+	}
+
+	if err := result.ErrorOrNil(); err != nil {
+		return err
+	}
+	for _, system := range downgrades {
+		if err := desc.SetHardwareVersion(system, newest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newestHardwareVersion returns the newest of the vmx-NN versions, or an
+// empty string if there are none.
+func newestHardwareVersion(versions []string) string {
+	newest, newestNumber := "", -1
+	for _, v := range versions {
+		n, err := hardwareVersionNumber(v)
+		if err != nil {
+			continue
+		}
+		if n > newestNumber {
+			newest, newestNumber = v, n
+		}
+	}
+	return newest
+}
+
+func intersect(a []string, b []string) []string {
+	var result []string
+	for _, v := range a {
+		if containsString(b, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
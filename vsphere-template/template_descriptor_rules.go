@@ -0,0 +1,109 @@
+package vsphere_template
+
+import (
+	"fmt"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/descriptor"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const (
+	hardwareRuleActionRemove  = "remove"
+	hardwareRuleActionReplace = "replace"
+)
+
+func hardwareRuleSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		ForceNew:    true,
+		Description: "Rules to remove or change virtual hardware items of the ovf before it is imported.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"resource_type": {
+					Type:        schema.TypeInt,
+					Optional:    true,
+					ForceNew:    true,
+					Description: "Match items with this CIM resource type, e.g. 35 for sound cards.",
+				},
+				"resource_sub_type": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					ForceNew:    true,
+					Description: "Match items with this resource sub type.",
+				},
+				"element_name": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					ForceNew:    true,
+					Description: "Match items with this element name.",
+				},
+				"action": {
+					Type:         schema.TypeString,
+					Required:     true,
+					ForceNew:     true,
+					ValidateFunc: validateHardwareRuleAction,
+					Description:  "What to do with matching items, remove or replace.",
+				},
+				"replace_resource_sub_type": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					ForceNew:    true,
+					Description: "The resource sub type to give matching items, with action replace.",
+				},
+			},
+		},
+	}
+}
+
+func validateHardwareRuleAction(v interface{}, k string) ([]string, []error) {
+	if v.(string) != hardwareRuleActionRemove && v.(string) != hardwareRuleActionReplace {
+		return nil, []error{fmt.Errorf("%q must be %q or %q, got %q", k, hardwareRuleActionRemove, hardwareRuleActionReplace, v)}
+	}
+	return nil, nil
+}
+
+// hardwareRules converts the hardware_rule blocks to descriptor item rules.
+func hardwareRules(d resourceGetter) ([]descriptor.ItemRule, error) {
+	var rules []descriptor.ItemRule
+	for i, raw := range d.Get("hardware_rule").([]interface{}) {
+		block := raw.(map[string]interface{})
+		r := descriptor.ItemRule{
+			ResourceType:       block["resource_type"].(int),
+			ResourceSubType:    block["resource_sub_type"].(string),
+			ElementName:        block["element_name"].(string),
+			Remove:             block["action"].(string) == hardwareRuleActionRemove,
+			SetResourceSubType: block["replace_resource_sub_type"].(string),
+		}
+		if r.ResourceType == 0 && r.ResourceSubType == "" && r.ElementName == "" {
+			return nil, fmt.Errorf("hardware_rule.%d: one of resource_type, resource_sub_type or element_name is required", i)
+		}
+		if !r.Remove && r.SetResourceSubType == "" {
+			return nil, fmt.Errorf("hardware_rule.%d: replace_resource_sub_type is required with action %q", i, hardwareRuleActionReplace)
+		}
+		if r.Remove && r.SetResourceSubType != "" {
+			return nil, fmt.Errorf("hardware_rule.%d: replace_resource_sub_type cannot be used with action %q", i, hardwareRuleActionRemove)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// transformDescriptor rewrites the descriptor before it is validated and
+// imported: the built-in fixups run first if enabled, then the hardware
+// rules in order.
+func transformDescriptor(d resourceGetter, desc *descriptor.Descriptor) error {
+	if d.Get("descriptor_fixups").(bool) {
+		if err := desc.ApplyFixups(); err != nil {
+			return fmt.Errorf("error applying descriptor fixups: %s", err)
+		}
+	}
+
+	rules, err := hardwareRules(d)
+	if err != nil {
+		return err
+	}
+	if err := desc.Transform(rules); err != nil {
+		return fmt.Errorf("error applying hardware rules: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+package vsphere_template
+
+import (
+	"context"
+	"fmt"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/datastore"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/descriptor"
+	"github.com/fredwangwang/terraform-provider-vspheretemplate/vsphere-template/storagepolicy"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/pbm"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+	"sort"
+)
+
+// diskProvisioningPerDisk are the provisioning types a single disk can be
+// given in a disk block.
+var diskProvisioningPerDisk = []string{
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeThin),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeThick),
+	string(types.OvfCreateImportSpecParamsDiskProvisioningTypeEagerZeroedThick),
+}
+
+func validateDiskBlockProvisioning(v interface{}, k string) ([]string, []error) {
+	for _, t := range diskProvisioningPerDisk {
+		if v.(string) == t {
+			return nil, nil
+		}
+	}
+	return nil, []error{fmt.Errorf("%q must be one of thin, thick or eagerZeroedThick, got %q", k, v)}
+}
+
+// diskConfig is the placement of a single disk, configured in a disk block.
+type diskConfig struct {
+	datastore     *object.Datastore
+	provisioning  string
+	storagePolicy string
+}
+
+// diskConfigs returns the disk blocks by OVF disk ID, with their datastores
+// located.
+func diskConfigs(client *govmomi.Client, d resourceGetter) (map[string]diskConfig, error) {
+	disks := map[string]diskConfig{}
+	for _, raw := range d.Get("disk").([]interface{}) {
+		disk := raw.(map[string]interface{})
+		id := disk["disk_id"].(string)
+
+		c := diskConfig{
+			provisioning:  disk["provisioning"].(string),
+			storagePolicy: disk["storage_policy_id"].(string),
+		}
+		if dsID := disk["datastore_id"].(string); dsID != "" {
+			ds, err := datastore.FromID(client, dsID)
+			if err != nil {
+				return nil, fmt.Errorf("disk %q: error locating datastore %q: %s", id, dsID, err)
+			}
+			c.datastore = ds
+		}
+		disks[id] = c
+	}
+	return disks, nil
+}
+
+// diskDatastores returns the datastore of the template and the datastores of
+// the disk blocks, without duplicates. The host of the import has to mount all
+// of them.
+func diskDatastores(ds *object.Datastore, disks map[string]diskConfig) []types.ManagedObjectReference {
+	ids := make([]string, 0, len(disks))
+	for id := range disks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	refs := []types.ManagedObjectReference{ds.Reference()}
+	for _, id := range ids {
+		if c := disks[id]; c.datastore != nil && !containsReference(refs, c.datastore.Reference()) {
+			refs = append(refs, c.datastore.Reference())
+		}
+	}
+	return refs
+}
+
+func containsReference(refs []types.ManagedObjectReference, ref types.ManagedObjectReference) bool {
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// diskPlan describes the disks of the ovf content being imported.
+type diskPlan struct {
+	// systems are the OVF disk IDs of every virtual system of the content, in
+	// the order vSphere adds the disks to the import spec.
+	systems [][]string
+	configs map[string]diskConfig
+	sizes   map[string]descriptor.DiskSize
+}
+
+// ids returns the OVF disk IDs of the i-th virtual system.
+func (p diskPlan) ids(i int) []string {
+	if i < len(p.systems) {
+		return p.systems[i]
+	}
+	return nil
+}
+
+// checkFreeSpace fails if any datastore the disks are put on has less free
+// space than the disks need. Thin provisioned disks need their populated
+// size, all others their full capacity. provisioning is the disk provisioning
+// type of disks without one of their own.
+func checkFreeSpace(plan diskPlan, ds *object.Datastore, provisioning string) error {
+	required := map[string]int64{}
+	datastores := map[string]*object.Datastore{}
+	for _, ids := range plan.systems {
+		for _, id := range ids {
+			target, p := ds, provisioning
+			if c, ok := plan.configs[id]; ok {
+				if c.datastore != nil {
+					target = c.datastore
+				}
+				if c.provisioning != "" {
+					p = c.provisioning
+				}
+			}
+
+			size := plan.sizes[id]
+			need := size.Capacity
+			if thinProvisioned(p) && size.Populated > 0 {
+				need = size.Populated
+			}
+
+			ref := target.Reference().Value
+			required[ref] += need
+			datastores[ref] = target
+		}
+	}
+
+	var result *multierror.Error
+	for ref, need := range required {
+		// datastores picked from a datastore cluster have no inventory path,
+		// their name is taken from the summary.
+		summary, err := datastore.Summary(datastores[ref])
+		if err != nil {
+			return fmt.Errorf("error fetching free space of datastore %q: %s", ref, err)
+		}
+		log.Printf("[DEBUG] datastore %q: %d bytes required, %d bytes free", ref, need, summary.FreeSpace)
+		if need > summary.FreeSpace {
+			result = multierror.Append(result, fmt.Errorf(
+				"datastore %q has %s free, but the disks of the ova need %s", summary.Name, gigabytes(summary.FreeSpace), gigabytes(need)))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+func thinProvisioned(provisioning string) bool {
+	switch types.OvfCreateImportSpecParamsDiskProvisioningType(provisioning) {
+	case types.OvfCreateImportSpecParamsDiskProvisioningTypeThin,
+		types.OvfCreateImportSpecParamsDiskProvisioningTypeSparse,
+		types.OvfCreateImportSpecParamsDiskProvisioningTypeSeSparse,
+		types.OvfCreateImportSpecParamsDiskProvisioningTypeMonolithicSparse,
+		types.OvfCreateImportSpecParamsDiskProvisioningTypeTwoGbMaxExtentSparse:
+		return true
+	}
+	return false
+}
+
+func gigabytes(bytes int64) string {
+	return fmt.Sprintf("%.2f GB", float64(bytes)/(1<<30))
+}
+
+// applyDiskConfigs moves the disks of the config spec of an import spec to
+// their configured datastores, and sets their provisioning type and storage
+// policy. Disks without a storage policy of their own get the policy of the
+// template, if any. ids are the OVF disk IDs of the virtual system, in the
+// order vSphere added the disks to the config spec.
+func applyDiskConfigs(spec *types.VirtualMachineConfigSpec, ids []string, disks map[string]diskConfig, policy string) {
+	i := 0
+	for _, change := range spec.DeviceChange {
+		deviceSpec := change.GetVirtualDeviceConfigSpec()
+		disk, ok := deviceSpec.Device.(*types.VirtualDisk)
+		if !ok {
+			continue
+		}
+		var id string
+		if i < len(ids) {
+			id = ids[i]
+		} else {
+			log.Printf("[WARN] import spec has more disks than the ovf, ignoring the disk blocks for the rest")
+		}
+		i++
+
+		c := disks[id]
+		if c.storagePolicy != "" {
+			deviceSpec.Profile = storagepolicy.ProfileSpec(c.storagePolicy)
+		} else if policy != "" {
+			deviceSpec.Profile = storagepolicy.ProfileSpec(policy)
+		}
+
+		if c.datastore != nil {
+			if backing, ok := disk.Backing.(types.BaseVirtualDeviceFileBackingInfo); ok {
+				ref := c.datastore.Reference()
+				file := backing.GetVirtualDeviceFileBackingInfo()
+				file.FileName = fmt.Sprintf("[%s]", c.datastore.Name())
+				file.Datastore = &ref
+			}
+		}
+
+		if c.provisioning != "" {
+			if backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok {
+				thin := c.provisioning == string(types.OvfCreateImportSpecParamsDiskProvisioningTypeThin)
+				eager := c.provisioning == string(types.OvfCreateImportSpecParamsDiskProvisioningTypeEagerZeroedThick)
+				backing.ThinProvisioned = &thin
+				backing.EagerlyScrub = &eager
+			} else {
+				log.Printf("[WARN] disk %q: the provisioning type of %T backings cannot be changed", id, disk.Backing)
+			}
+		}
+	}
+}
+
+// virtualDisks returns the disks of the virtual machine, ordered by device key,
+// which is the order they were created in.
+func virtualDisks(props *mo.VirtualMachine) []*types.VirtualDisk {
+	var disks []*types.VirtualDisk
+	if props.Config == nil {
+		return disks
+	}
+	for _, device := range props.Config.Hardware.Device {
+		if disk, ok := device.(*types.VirtualDisk); ok {
+			disks = append(disks, disk)
+		}
+	}
+	sort.Slice(disks, func(i, j int) bool {
+		return disks[i].Key < disks[j].Key
+	})
+	return disks
+}
+
+// setDiskKeys saves the device keys of the disks of the virtual machine in the
+// disk blocks, so that their storage policies can be read and updated later.
+// ids are the OVF disk IDs of the virtual system of the virtual machine.
+func setDiskKeys(d *schema.ResourceData, props *mo.VirtualMachine, ids []string) {
+	keys := map[string]int32{}
+	for i, disk := range virtualDisks(props) {
+		if i < len(ids) {
+			keys[ids[i]] = disk.Key
+		}
+	}
+
+	blocks := d.Get("disk").([]interface{})
+	for _, raw := range blocks {
+		block := raw.(map[string]interface{})
+		block["key"] = int(keys[block["disk_id"].(string)])
+	}
+	d.Set("disk", blocks)
+}
+
+// validateStoragePolicies checks that the storage policies of the template
+// and its disk blocks exist. The storage policy service is only asked when a
+// policy is configured, so vCenters without it keep working.
+func validateStoragePolicies(ctx context.Context, d resourceGetter, client *govmomi.Client) error {
+	// policies are the configured storage policy IDs, by what they are
+	// configured for.
+	policies := map[string]string{}
+	if v, ok := d.GetOk("storage_policy_id"); ok {
+		policies["storage_policy_id"] = v.(string)
+	}
+	for _, raw := range d.Get("disk").([]interface{}) {
+		disk := raw.(map[string]interface{})
+		if id := disk["storage_policy_id"].(string); id != "" {
+			policies[fmt.Sprintf("disk %q", disk["disk_id"])] = id
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	pc, err := storagepolicy.NewClient(ctx, client)
+	if err != nil {
+		return err
+	}
+	var result *multierror.Error
+	for k, id := range policies {
+		if err := storagepolicy.Validate(ctx, pc, id); err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s: %s", k, err))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// readStoragePolicies saves the storage policies of the virtual machine and
+// its disks. Policies are only read when they are configured, so vCenters
+// without the storage policy service keep working.
+func readStoragePolicies(ctx context.Context, d *schema.ResourceData, client *govmomi.Client, vm types.ManagedObjectReference) error {
+	var pc *pbm.Client
+	connect := func() error {
+		if pc != nil {
+			return nil
+		}
+		var err error
+		pc, err = storagepolicy.NewClient(ctx, client)
+		return err
+	}
+
+	if d.Get("storage_policy_id").(string) != "" {
+		if err := connect(); err != nil {
+			return err
+		}
+		policy, err := storagepolicy.ForVirtualMachine(ctx, client, pc, vm)
+		if err != nil {
+			return fmt.Errorf("error reading storage policy of virtual machine %q: %s", vm.Value, err)
+		}
+		d.Set("storage_policy_id", policy)
+	}
+
+	blocks := d.Get("disk").([]interface{})
+	var changed bool
+	for _, raw := range blocks {
+		block := raw.(map[string]interface{})
+		key := block["key"].(int)
+		if key == 0 || block["storage_policy_id"].(string) == "" {
+			continue
+		}
+		if err := connect(); err != nil {
+			return err
+		}
+		policy, err := storagepolicy.ForVirtualDisk(ctx, client, pc, vm, int32(key))
+		if err != nil {
+			return fmt.Errorf("error reading storage policy of disk %q: %s", block["disk_id"], err)
+		}
+		block["storage_policy_id"] = policy
+		changed = true
+	}
+	if changed {
+		d.Set("disk", blocks)
+	}
+	return nil
+}
+
+// diskChanges returns the device changes that apply changed storage policies
+// and sizes to the disks of the virtual machine. Disks without a storage
+// policy of their own follow a changed storage_policy_id of the template.
+// Only the first virtual machine is primary; the disk blocks only know the
+// device keys of its disks. Disks can only grow.
+func diskChanges(d *schema.ResourceData, props *mo.VirtualMachine, primary bool) ([]types.BaseVirtualDeviceConfigSpec, error) {
+	blocks := map[int32]int{}
+	if primary {
+		for i, raw := range d.Get("disk").([]interface{}) {
+			blocks[int32(raw.(map[string]interface{})["key"].(int))] = i
+		}
+	}
+	// during create, the import spec already assigned the storage policies.
+	policies := !d.IsNewResource()
+	policy := d.Get("storage_policy_id").(string)
+	policyChanged := policies && d.HasChange("storage_policy_id")
+
+	var changes []types.BaseVirtualDeviceConfigSpec
+	for _, disk := range virtualDisks(props) {
+		change := &types.VirtualDeviceConfigSpec{
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+			Device:    disk,
+		}
+		changed := false
+
+		i, ok := blocks[disk.Key]
+		if !ok {
+			if policyChanged {
+				change.Profile = storagepolicy.ProfileSpec(policy)
+				changes = append(changes, change)
+			}
+			continue
+		}
+
+		block := d.Get(fmt.Sprintf("disk.%d", i)).(map[string]interface{})
+		own := block["storage_policy_id"].(string)
+		ownChanged := policies && d.HasChange(fmt.Sprintf("disk.%d.storage_policy_id", i))
+		switch {
+		case own != "" && ownChanged:
+			change.Profile = storagepolicy.ProfileSpec(own)
+			changed = true
+		case own == "" && (policyChanged || ownChanged):
+			change.Profile = storagepolicy.ProfileSpec(policy)
+			changed = true
+		}
+
+		if size := block["size"].(int); size > 0 && d.HasChange(fmt.Sprintf("disk.%d.size", i)) {
+			capacity := int64(size) * 1024 * 1024
+			if capacity < disk.CapacityInKB {
+				return nil, fmt.Errorf("cannot shrink disk %q from %s to %d GB", block["disk_id"], gigabytes(disk.CapacityInKB*1024), size)
+			}
+			if capacity > disk.CapacityInKB {
+				disk.CapacityInKB = capacity
+				disk.CapacityInBytes = capacity * 1024
+				changed = true
+			}
+		}
+		if changed {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// readDiskSizes saves the sizes of the disks of the virtual machine in the
+// disk blocks, in GB.
+func readDiskSizes(d *schema.ResourceData, props *mo.VirtualMachine) {
+	sizes := map[int32]int{}
+	for _, disk := range virtualDisks(props) {
+		sizes[disk.Key] = diskSizeGB(disk.CapacityInKB)
+	}
+
+	blocks := d.Get("disk").([]interface{})
+	for _, raw := range blocks {
+		block := raw.(map[string]interface{})
+		if size, ok := sizes[int32(block["key"].(int))]; ok {
+			block["size"] = size
+		}
+	}
+	d.Set("disk", blocks)
+}
+
+// growDiskSizes sets the capacity of disks with a larger size in their disk
+// block to that size, so the free space check accounts for disks grown after
+// the import.
+func growDiskSizes(d resourceGetter, sizes map[string]descriptor.DiskSize) {
+	for _, raw := range d.Get("disk").([]interface{}) {
+		block := raw.(map[string]interface{})
+		id := block["disk_id"].(string)
+		size, ok := sizes[id]
+		if capacity := int64(block["size"].(int)) << 30; ok && capacity > size.Capacity {
+			size.Capacity = capacity
+			sizes[id] = size
+		}
+	}
+}
+
+// validateDiskSizes checks that no disk block asks for a disk smaller than
+// the disk in the ovf.
+func validateDiskSizes(d resourceGetter, sizes map[string]descriptor.DiskSize) error {
+	var result *multierror.Error
+	for _, raw := range d.Get("disk").([]interface{}) {
+		block := raw.(map[string]interface{})
+		size := block["size"].(int)
+		capacity, ok := sizes[block["disk_id"].(string)]
+		if size > 0 && ok && int64(size)<<30 < capacity.Capacity {
+			result = multierror.Append(result, fmt.Errorf(
+				"disk %q: size %d GB is smaller than the %s of the disk in the ovf", block["disk_id"], size, gigabytes(capacity.Capacity)))
+		}
+	}
+	return result.ErrorOrNil()
+}
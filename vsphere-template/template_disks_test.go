@@ -0,0 +1,102 @@
+package vsphere_template
+
+import (
+	"fmt"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiskChanges(t *testing.T) {
+	cases := []struct {
+		name string
+		// policy, ownPolicy and size configure the template and its disk
+		// block, which was imported with policy-a, no policy of its own and
+		// 16 GB.
+		policy    string
+		ownPolicy string
+		size      int
+		primary   bool
+		// vmSize is the size of the disk in the virtual machine, in GB.
+		vmSize int64
+		want   []string
+		err    string
+	}{
+		{"unchanged", "policy-a", "", 16, true, 16, nil, ""},
+		{"grow", "policy-a", "", 20, true, 16, []string{"2000: 20 GB"}, ""},
+		{"grown outside of terraform", "policy-a", "", 20, true, 20, nil, ""},
+		{"shrink", "policy-a", "", 18, true, 20, nil, `cannot shrink disk "vmdisk1"`},
+		{"template policy", "policy-b", "", 16, true, 16, []string{"2000: policy-b", "2001: policy-b"}, ""},
+		{"own policy", "policy-a", "policy-c", 16, true, 16, []string{"2000: policy-c"}, ""},
+		{"own policy and template policy", "policy-b", "policy-c", 16, true, 16, []string{"2000: policy-c", "2001: policy-b"}, ""},
+		{"grow and policy", "policy-a", "policy-c", 20, true, 16, []string{"2000: 20 GB policy-c"}, ""},
+		// the disk blocks only describe the disks of the first virtual machine.
+		{"other virtual machine", "policy-a", "policy-c", 20, false, 16, nil, ""},
+		{"other virtual machine with template policy", "policy-b", "", 16, false, 16, []string{"2000: policy-b", "2001: policy-b"}, ""},
+	}
+
+	state := testTemplateState(map[string]string{
+		"storage_policy_id":        "policy-a",
+		"disk.#":                   "1",
+		"disk.0.disk_id":           "vmdisk1",
+		"disk.0.size":              "16",
+		"disk.0.key":               "2000",
+		"disk.0.datastore_id":      "",
+		"disk.0.provisioning":      "",
+		"disk.0.storage_policy_id": "",
+	})
+
+	for _, c := range cases {
+		d := testTemplateData(t, state, testTemplateConfig(t, map[string]interface{}{
+			"storage_policy_id": c.policy,
+			"disk": []interface{}{map[string]interface{}{
+				"disk_id":           "vmdisk1",
+				"storage_policy_id": c.ownPolicy,
+				"size":              c.size,
+			}},
+		}))
+		props := &mo.VirtualMachine{Config: &types.VirtualMachineConfigInfo{}}
+		props.Config.Hardware.Device = []types.BaseVirtualDevice{
+			&types.VirtualDisk{VirtualDevice: types.VirtualDevice{Key: 2001}, CapacityInKB: 8 << 20},
+			&types.VirtualDisk{VirtualDevice: types.VirtualDevice{Key: 2000}, CapacityInKB: c.vmSize << 20},
+		}
+
+		changes, err := diskChanges(d, props, c.primary)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+
+		var got []string
+		for _, change := range changes {
+			got = append(got, describeDiskChange(change.GetVirtualDeviceConfigSpec(), c.vmSize))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got changes %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// describeDiskChange describes the size and storage policy a device change
+// gives a disk, the size only if it differs from vmSize.
+func describeDiskChange(change *types.VirtualDeviceConfigSpec, vmSize int64) string {
+	disk := change.Device.(*types.VirtualDisk)
+	var parts []string
+	if disk.Key == 2000 && disk.CapacityInKB != vmSize<<20 {
+		parts = append(parts, fmt.Sprintf("%d GB", disk.CapacityInKB>>20))
+	}
+	for _, p := range change.Profile {
+		if defined, ok := p.(*types.VirtualMachineDefinedProfileSpec); ok {
+			parts = append(parts, defined.ProfileId)
+		}
+	}
+	return fmt.Sprintf("%d: %s", disk.Key, strings.Join(parts, " "))
+}
@@ -0,0 +1,64 @@
+package vsphere_template
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// extraConfigSpec adds the changed extra_config keys to the config spec, and
+// reports whether it changed anything. Keys removed from extra_config are
+// removed from the virtual machine by setting them to an empty value.
+func extraConfigSpec(d *schema.ResourceData, props *mo.VirtualMachine, spec *types.VirtualMachineConfigSpec) bool {
+	if !d.HasChange("extra_config") {
+		return false
+	}
+
+	current := extraConfig(props)
+	o, n := d.GetChange("extra_config")
+	changed := false
+	for k := range o.(map[string]interface{}) {
+		if _, ok := n.(map[string]interface{})[k]; !ok {
+			spec.ExtraConfig = append(spec.ExtraConfig, &types.OptionValue{Key: k, Value: ""})
+			changed = true
+		}
+	}
+	for k, v := range n.(map[string]interface{}) {
+		if value, ok := current[k]; ok && value == v.(string) {
+			continue
+		}
+		spec.ExtraConfig = append(spec.ExtraConfig, &types.OptionValue{Key: k, Value: v.(string)})
+		changed = true
+	}
+	return changed
+}
+
+// readExtraConfig saves the current values of the extra_config keys. Other
+// keys of the virtual machine, like the ones set by the ovf or vSphere, are
+// not tracked.
+func readExtraConfig(d *schema.ResourceData, props *mo.VirtualMachine) {
+	current := extraConfig(props)
+	values := map[string]interface{}{}
+	for k := range d.Get("extra_config").(map[string]interface{}) {
+		if v, ok := current[k]; ok {
+			values[k] = v
+		}
+	}
+	d.Set("extra_config", values)
+}
+
+// extraConfig returns the string values of the extra config of the virtual
+// machine, by key.
+func extraConfig(props *mo.VirtualMachine) map[string]string {
+	values := map[string]string{}
+	if props.Config == nil {
+		return values
+	}
+	for _, option := range props.Config.ExtraConfig {
+		value := option.GetOptionValue()
+		if s, ok := value.Value.(string); ok {
+			values[value.Key] = s
+		}
+	}
+	return values
+}
@@ -0,0 +1,288 @@
+package vsphere_template
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// hardwareSchema returns the attributes describing the virtual hardware of
+// the imported template. num_cpus, memory and hardware_version can be set to
+// resize and upgrade the template after the import.
+func hardwareSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"moid": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The managed object ID of the template.",
+		},
+		"inventory_path": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The inventory path of the template.",
+		},
+		"num_cpus": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			Computed:     true,
+			ValidateFunc: validatePositive,
+			Description:  "The number of virtual CPUs of the template. Defaults to the number the ovf asks for.",
+		},
+		"memory": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			Computed:     true,
+			ValidateFunc: validatePositive,
+			Description:  "The memory of the template, in MB. Defaults to the memory the ovf asks for.",
+		},
+		"firmware": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "The firmware interface of the template, bios or efi.",
+		},
+		"hardware_version": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Computed:     true,
+			ValidateFunc: validateHardwareVersion,
+			Description:  "The virtual hardware version of the template, for example vmx-13. Setting a newer version upgrades the template.",
+		},
+		"disks": {
+			Type:        schema.TypeList,
+			Computed:    true,
+			Description: "The virtual disks of the template, in device order.",
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"label": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"size": {
+						Type:     schema.TypeInt,
+						Computed: true,
+					},
+					"thin_provisioned": {
+						Type:     schema.TypeBool,
+						Computed: true,
+					},
+				},
+			},
+		},
+		"network_interfaces": {
+			Type:        schema.TypeList,
+			Computed:    true,
+			Description: "The network interfaces of the template, in device order.",
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"adapter_type": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"network_id": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+				},
+			},
+		},
+	}
+}
+
+// setHardware saves the virtual hardware of the template to the resource data.
+func setHardware(d *schema.ResourceData, vm *object.VirtualMachine, props *mo.VirtualMachine) {
+	d.Set("moid", vm.Reference().Value)
+	d.Set("inventory_path", vm.InventoryPath)
+	d.Set("num_cpus", int(props.Config.Hardware.NumCPU))
+	d.Set("memory", int(props.Config.Hardware.MemoryMB))
+	d.Set("firmware", props.Config.Firmware)
+	d.Set("hardware_version", props.Config.Version)
+
+	devices := object.VirtualDeviceList(props.Config.Hardware.Device)
+	d.Set("disks", flattenDisks(devices))
+	d.Set("network_interfaces", flattenNetworkInterfaces(devices))
+}
+
+// sizingSpec adds changed num_cpus and memory to the config spec, and reports
+// whether it changed anything. Values that already match the virtual machine
+// are left out.
+func sizingSpec(d *schema.ResourceData, props *mo.VirtualMachine, spec *types.VirtualMachineConfigSpec) bool {
+	changed := false
+	if v, ok := d.GetOk("num_cpus"); ok && d.HasChange("num_cpus") && int32(v.(int)) != props.Config.Hardware.NumCPU {
+		spec.NumCPUs = int32(v.(int))
+		changed = true
+	}
+	if v, ok := d.GetOk("memory"); ok && d.HasChange("memory") && int32(v.(int)) != props.Config.Hardware.MemoryMB {
+		spec.MemoryMB = int64(v.(int))
+		changed = true
+	}
+	return changed
+}
+
+// upgradeHardware upgrades the virtual hardware of the virtual machine to a
+// changed hardware_version. Virtual hardware cannot be downgraded.
+func upgradeHardware(ctx context.Context, d *schema.ResourceData, vm *object.VirtualMachine, props *mo.VirtualMachine) error {
+	if !hardwareUpgradeNeeded(d, props) {
+		return nil
+	}
+	version := d.Get("hardware_version").(string)
+
+	target, _ := hardwareVersionNumber(version)
+	current, err := hardwareVersionNumber(props.Config.Version)
+	if err == nil && target < current {
+		return fmt.Errorf("cannot downgrade the virtual hardware of %q from %s to %s", vm.InventoryPath, props.Config.Version, version)
+	}
+
+	log.Printf("[INFO] Upgrading virtual hardware of %q to %s...\n", vm.InventoryPath, version)
+	task, err := vm.UpgradeVM(ctx, version)
+	if err != nil {
+		return fmt.Errorf("error upgrading virtual hardware of %q: %s", vm.InventoryPath, err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		return fmt.Errorf("error upgrading virtual hardware of %q: %s", vm.InventoryPath, err)
+	}
+	return nil
+}
+
+// hardwareUpgradeNeeded reports whether hardware_version changed and differs
+// from the version of the virtual machine.
+func hardwareUpgradeNeeded(d *schema.ResourceData, props *mo.VirtualMachine) bool {
+	version := d.Get("hardware_version").(string)
+	return version != "" && d.HasChange("hardware_version") && version != props.Config.Version
+}
+
+// hardwareVersionNumber returns the number of a vmx-NN hardware version.
+func hardwareVersionNumber(version string) (int, error) {
+	if !strings.HasPrefix(version, "vmx-") {
+		return 0, fmt.Errorf("%q is not a hardware version like vmx-13", version)
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "vmx-"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a hardware version like vmx-13", version)
+	}
+	return n, nil
+}
+
+func validateHardwareVersion(v interface{}, k string) ([]string, []error) {
+	if _, err := hardwareVersionNumber(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %s", k, err)}
+	}
+	return nil, nil
+}
+
+func validatePositive(v interface{}, k string) ([]string, []error) {
+	if v.(int) <= 0 {
+		return nil, []error{fmt.Errorf("%q must be greater than 0, got %d", k, v.(int))}
+	}
+	return nil, nil
+}
+
+// diffHardware rejects plans that downgrade the virtual hardware or shrink a
+// disk of an existing template, which vSphere does not support.
+func diffHardware(d *schema.ResourceDiff) error {
+	if d.Id() == "" {
+		return nil
+	}
+
+	if d.HasChange("hardware_version") && d.NewValueKnown("hardware_version") {
+		o, n := d.GetChange("hardware_version")
+		current, err := hardwareVersionNumber(o.(string))
+		target, _ := hardwareVersionNumber(n.(string))
+		if err == nil && n.(string) != "" && target < current {
+			return fmt.Errorf("hardware_version: cannot downgrade the virtual hardware from %s to %s", o, n)
+		}
+	}
+
+	for i := range d.Get("disk").([]interface{}) {
+		k := fmt.Sprintf("disk.%d.size", i)
+		if !d.HasChange(k) || !d.NewValueKnown(k) || d.HasChange(fmt.Sprintf("disk.%d.disk_id", i)) {
+			continue
+		}
+		o, n := d.GetChange(k)
+		if n.(int) != 0 && n.(int) < o.(int) {
+			return fmt.Errorf("%s: cannot shrink disk %q from %d GB to %d GB", k, d.Get(fmt.Sprintf("disk.%d.disk_id", i)), o, n)
+		}
+	}
+	return nil
+}
+
+func flattenDisks(devices object.VirtualDeviceList) []interface{} {
+	var disks []interface{}
+	for _, device := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		disk := device.(*types.VirtualDisk)
+
+		thin := false
+		if backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok && backing.ThinProvisioned != nil {
+			thin = *backing.ThinProvisioned
+		}
+
+		disks = append(disks, map[string]interface{}{
+			"label": devices.Name(disk),
+			// size is reported in GB, the same unit the vsphere provider uses
+			// for the disks of virtual machines.
+			"size":             diskSizeGB(disk.CapacityInKB),
+			"thin_provisioned": thin,
+		})
+	}
+	return disks
+}
+
+// diskSizeGB returns the capacity of a disk in whole GB, rounded up, so that
+// disks of less than a GB or of a fraction of a GB are not reported smaller
+// than they are.
+func diskSizeGB(capacityInKB int64) int {
+	const kbPerGB = 1024 * 1024
+	return int((capacityInKB + kbPerGB - 1) / kbPerGB)
+}
+
+func flattenNetworkInterfaces(devices object.VirtualDeviceList) []interface{} {
+	var nics []interface{}
+	for _, device := range devices.SelectByType((*types.VirtualEthernetCard)(nil)) {
+		card := device.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+
+		var networkID string
+		switch backing := card.Backing.(type) {
+		case *types.VirtualEthernetCardNetworkBackingInfo:
+			if backing.Network != nil {
+				networkID = backing.Network.Value
+			}
+		case *types.VirtualEthernetCardDistributedVirtualPortBackingInfo:
+			networkID = backing.Port.PortgroupKey
+		case *types.VirtualEthernetCardOpaqueNetworkBackingInfo:
+			networkID = backing.OpaqueNetworkId
+		}
+
+		nics = append(nics, map[string]interface{}{
+			"adapter_type": ethernetCardType(device),
+			"network_id":   networkID,
+		})
+	}
+	return nics
+}
+
+// ethernetCardType returns the adapter type of the ethernet card, using the
+// same names as govc and the vsphere provider.
+func ethernetCardType(device types.BaseVirtualDevice) string {
+	switch device.(type) {
+	case *types.VirtualE1000:
+		return "e1000"
+	case *types.VirtualE1000e:
+		return "e1000e"
+	case *types.VirtualPCNet32:
+		return "pcnet32"
+	case *types.VirtualSriovEthernetCard:
+		return "sriov"
+	case *types.VirtualVmxnet2:
+		return "vmxnet2"
+	case *types.VirtualVmxnet3:
+		return "vmxnet3"
+	case *types.VirtualVmxnet:
+		return "vmxnet"
+	}
+	return object.VirtualDeviceList{}.TypeName(device)
+}
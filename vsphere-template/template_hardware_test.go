@@ -0,0 +1,86 @@
+package vsphere_template
+
+import (
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"strings"
+	"testing"
+)
+
+func TestSizingSpec(t *testing.T) {
+	cases := []struct {
+		name    string
+		vmCPUs  int32
+		config  map[string]interface{}
+		changed bool
+		cpus    int32
+		memory  int64
+	}{
+		{"unchanged", 2, nil, false, 0, 0},
+		{"num_cpus", 2, map[string]interface{}{"num_cpus": 4}, true, 4, 0},
+		{"memory", 2, map[string]interface{}{"memory": 2048}, true, 0, 2048},
+		{"both", 2, map[string]interface{}{"num_cpus": 4, "memory": 2048}, true, 4, 2048},
+		// the virtual machine was already resized outside of terraform.
+		{"matching the virtual machine", 8, map[string]interface{}{"num_cpus": 8}, false, 0, 0},
+	}
+
+	for _, c := range cases {
+		d := testTemplateData(t, testTemplateState(map[string]string{"num_cpus": "2", "memory": "1024"}), testTemplateConfig(t, c.config))
+		props := &mo.VirtualMachine{Config: &types.VirtualMachineConfigInfo{
+			Hardware: types.VirtualHardware{NumCPU: c.vmCPUs, MemoryMB: 1024},
+		}}
+
+		var spec types.VirtualMachineConfigSpec
+		if changed := sizingSpec(d, props, &spec); changed != c.changed {
+			t.Errorf("%s: got changed %t, want %t", c.name, changed, c.changed)
+		}
+		if spec.NumCPUs != c.cpus || spec.MemoryMB != c.memory {
+			t.Errorf("%s: got %d CPUs and %d MB, want %d CPUs and %d MB", c.name, spec.NumCPUs, spec.MemoryMB, c.cpus, c.memory)
+		}
+	}
+}
+
+func TestDiffHardware(t *testing.T) {
+	state := testTemplateState(map[string]string{
+		"hardware_version":         "vmx-13",
+		"disk.#":                   "1",
+		"disk.0.disk_id":           "vmdisk1",
+		"disk.0.size":              "16",
+		"disk.0.key":               "2000",
+		"disk.0.datastore_id":      "",
+		"disk.0.provisioning":      "",
+		"disk.0.storage_policy_id": "",
+	})
+
+	cases := []struct {
+		name    string
+		version interface{}
+		size    interface{}
+		err     string
+	}{
+		{"unchanged", "vmx-13", 16, ""},
+		{"upgrade", "vmx-14", 16, ""},
+		{"downgrade", "vmx-11", 16, "cannot downgrade the virtual hardware from vmx-13 to vmx-11"},
+		{"unknown hardware version", unknown, 16, ""},
+		{"grow disk", "vmx-13", 20, ""},
+		{"shrink disk", "vmx-13", 10, `cannot shrink disk "vmdisk1" from 16 GB to 10 GB`},
+		{"unknown disk size", "vmx-13", unknown, ""},
+	}
+
+	for _, c := range cases {
+		config := testTemplateConfig(t, map[string]interface{}{
+			"hardware_version": c.version,
+			"disk":             []interface{}{map[string]interface{}{"disk_id": "vmdisk1", "size": c.size}},
+		})
+		_, err := resourceVspheretemplateOvaTemplate().Diff(state, config, testMeta())
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		}
+	}
+}
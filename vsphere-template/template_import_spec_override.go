@@ -0,0 +1,150 @@
+package vsphere_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vmware/govmomi/vim25/types"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// managedConfigSpecFields are set by the provider from other attributes and
+// cannot be overridden.
+var managedConfigSpecFields = map[string]string{
+	"name":         "name",
+	"uuid":         "uuid",
+	"annotation":   "annotation",
+	"vmprofile":    "storage_policy_id",
+	"devicechange": "disk and hardware_rule",
+}
+
+// importSpecOverride is a parsed import_spec_override: the decoded config
+// spec, the fields that were set in it, and the extraConfig options, which
+// are decoded separately since their type is abstract.
+type importSpecOverride struct {
+	spec        types.VirtualMachineConfigSpec
+	fields      []string
+	extraConfig []types.BaseOptionValue
+}
+
+// extraConfigOption is an element of extraConfig in import_spec_override.
+type extraConfigOption struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// parseImportSpecOverride decodes a JSON object of VirtualMachineConfigSpec
+// fields, like {"cpuHotAddEnabled": true}. extraConfig is a list of key and
+// value pairs. Unknown fields, values of the wrong type and fields managed by
+// other attributes are errors.
+func parseImportSpecOverride(s string) (*importSpecOverride, error) {
+	o := &importSpecOverride{}
+	if strings.TrimSpace(s) == "" {
+		return o, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("must be a JSON object: %s", err)
+	}
+
+	specType := reflect.TypeOf(o.spec)
+	for key, value := range raw {
+		if strings.EqualFold(key, "extraConfig") {
+			options, err := parseExtraConfigOverride(value)
+			if err != nil {
+				return nil, err
+			}
+			o.extraConfig = options
+			delete(raw, key)
+			continue
+		}
+		if attr, ok := managedConfigSpecFields[strings.ToLower(key)]; ok {
+			return nil, fmt.Errorf("%q cannot be overridden, use %s instead", key, attr)
+		}
+		field, ok := specType.FieldByNameFunc(func(name string) bool {
+			return strings.EqualFold(name, key)
+		})
+		if !ok || field.Anonymous {
+			return nil, fmt.Errorf("%q is not a field of VirtualMachineConfigSpec", key)
+		}
+		o.fields = append(o.fields, field.Name)
+	}
+	sort.Strings(o.fields)
+
+	rest, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(rest))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o.spec); err != nil {
+		return nil, fmt.Errorf("invalid VirtualMachineConfigSpec: %s", err)
+	}
+	return o, nil
+}
+
+// parseExtraConfigOverride decodes the extraConfig of import_spec_override,
+// like [{"key": "sched.cpu.latencySensitivity", "value": "high"}].
+func parseExtraConfigOverride(raw json.RawMessage) ([]types.BaseOptionValue, error) {
+	var options []extraConfigOption
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&options); err != nil {
+		return nil, fmt.Errorf("invalid extraConfig, expected a list of key and value strings: %s", err)
+	}
+
+	var result []types.BaseOptionValue
+	for _, option := range options {
+		if option.Key == "" {
+			return nil, errors.New("invalid extraConfig: every option needs a key")
+		}
+		result = append(result, &types.OptionValue{Key: option.Key, Value: option.Value})
+	}
+	return result, nil
+}
+
+// apply copies the overridden fields to the config spec. extraConfig options
+// replace options with the same key from the ovf, and keep the others.
+func (o *importSpecOverride) apply(spec *types.VirtualMachineConfigSpec) {
+	from := reflect.ValueOf(o.spec)
+	to := reflect.ValueOf(spec).Elem()
+	for _, name := range o.fields {
+		to.FieldByName(name).Set(from.FieldByName(name))
+	}
+
+	if len(o.extraConfig) == 0 {
+		return
+	}
+	overridden := map[string]bool{}
+	for _, option := range o.extraConfig {
+		overridden[option.GetOptionValue().Key] = true
+	}
+	var extraConfig []types.BaseOptionValue
+	for _, option := range spec.ExtraConfig {
+		if !overridden[option.GetOptionValue().Key] {
+			extraConfig = append(extraConfig, option)
+		}
+	}
+	spec.ExtraConfig = append(extraConfig, o.extraConfig...)
+}
+
+func validateImportSpecOverride(v interface{}, k string) ([]string, []error) {
+	if _, err := parseImportSpecOverride(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %s", k, err)}
+	}
+	return nil, nil
+}
+
+// normalizeImportSpecOverride stores the JSON in compact form, so that
+// formatting changes do not show up as a diff.
+func normalizeImportSpecOverride(v interface{}) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(v.(string))); err != nil {
+		return v.(string)
+	}
+	return buf.String()
+}
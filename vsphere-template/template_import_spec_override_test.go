@@ -0,0 +1,109 @@
+package vsphere_template
+
+import (
+	"github.com/vmware/govmomi/vim25/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseImportSpecOverride(t *testing.T) {
+	cases := []struct {
+		name   string
+		json   string
+		fields []string
+		err    string
+	}{
+		{"empty", "", nil, ""},
+		{"blank", "  \n", nil, ""},
+		{"fields", `{"cpuHotAddEnabled": true, "NumCPUs": 4}`, []string{"CpuHotAddEnabled", "NumCPUs"}, ""},
+		{"nested", `{"latencySensitivity": {"level": "high"}}`, []string{"LatencySensitivity"}, ""},
+		{"extraConfig", `{"extraConfig": [{"key": "a", "value": "1"}]}`, nil, ""},
+		{"not an object", `[]`, nil, "must be a JSON object"},
+		{"invalid json", `{"numCPUs": }`, nil, "must be a JSON object"},
+		{"unknown field", `{"cpuHotAdd": true}`, nil, `"cpuHotAdd" is not a field of VirtualMachineConfigSpec`},
+		{"unknown nested field", `{"latencySensitivity": {"levle": "high"}}`, nil, `unknown field "levle"`},
+		{"wrong type", `{"numCPUs": "4"}`, nil, "cannot unmarshal string"},
+		{"managed field", `{"UUID": "x"}`, nil, `"UUID" cannot be overridden, use uuid instead`},
+		{"managed devices", `{"deviceChange": []}`, nil, "use disk and hardware_rule instead"},
+		{"abstract field", `{"vAppConfig": {"product": []}}`, nil, "invalid VirtualMachineConfigSpec"},
+		{"extraConfig not a list", `{"extraConfig": {"a": "1"}}`, nil, "invalid extraConfig"},
+		{"extraConfig unknown field", `{"extraConfig": [{"key": "a", "val": "1"}]}`, nil, `unknown field "val"`},
+		{"extraConfig number", `{"extraConfig": [{"key": "a", "value": 1}]}`, nil, "invalid extraConfig"},
+		{"extraConfig without key", `{"extraConfig": [{"value": "1"}]}`, nil, "every option needs a key"},
+	}
+
+	for _, c := range cases {
+		o, err := parseImportSpecOverride(c.json)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, got: %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(o.fields, c.fields) {
+			t.Errorf("%s: got fields %v, want %v", c.name, o.fields, c.fields)
+		}
+	}
+}
+
+func TestImportSpecOverrideApply(t *testing.T) {
+	o, err := parseImportSpecOverride(`{
+		"numCPUs": 4,
+		"latencySensitivity": {"level": "high"},
+		"extraConfig": [
+			{"key": "sched.cpu.latencySensitivity", "value": "high"},
+			{"key": "disk.EnableUUID", "value": "TRUE"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := types.VirtualMachineConfigSpec{
+		Name:     "template",
+		NumCPUs:  1,
+		MemoryMB: 1024,
+		ExtraConfig: []types.BaseOptionValue{
+			&types.OptionValue{Key: "disk.EnableUUID", Value: "FALSE"},
+			&types.OptionValue{Key: "svga.present", Value: "TRUE"},
+		},
+	}
+	o.apply(&spec)
+
+	if spec.NumCPUs != 4 || spec.LatencySensitivity == nil || spec.LatencySensitivity.Level != "high" {
+		t.Errorf("overridden fields were not applied: %+v", spec)
+	}
+	if spec.Name != "template" || spec.MemoryMB != 1024 {
+		t.Errorf("other fields were changed: %+v", spec)
+	}
+
+	got := map[string]interface{}{}
+	var keys []string
+	for _, option := range spec.ExtraConfig {
+		v := option.GetOptionValue()
+		got[v.Key] = v.Value
+		keys = append(keys, v.Key)
+	}
+	want := map[string]interface{}{
+		"svga.present":                 "TRUE",
+		"sched.cpu.latencySensitivity": "high",
+		"disk.EnableUUID":              "TRUE",
+	}
+	if !reflect.DeepEqual(got, want) || len(keys) != len(want) {
+		t.Errorf("got extra config %v (keys %v), want %v", got, keys, want)
+	}
+}
+
+func TestNormalizeImportSpecOverride(t *testing.T) {
+	if got := normalizeImportSpecOverride("{\n  \"numCPUs\": 4\n}\n"); got != `{"numCPUs":4}` {
+		t.Errorf("got %q", got)
+	}
+	if got := normalizeImportSpecOverride("not json"); got != "not json" {
+		t.Errorf("got %q", got)
+	}
+}
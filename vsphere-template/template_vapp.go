@@ -0,0 +1,197 @@
+package vsphere_template
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// ovfEnvironmentTransports are the ways vSphere can pass the ovf environment
+// to the guest: through VMware Tools, or on a mounted iso.
+var ovfEnvironmentTransports = []string{"com.vmware.guestInfo", "iso"}
+
+// vAppSchema returns the schema of the vapp block, the vApp options of the
+// template.
+func vAppSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: "The vApp options of the template.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"enabled": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     true,
+					Description: "Whether the vApp options are enabled. Disabling them removes them, including the ovf properties.",
+				},
+				"ovf_environment_transport": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					Computed:    true,
+					Description: "The transports of the ovf environment, com.vmware.guestInfo (VMware Tools) and iso.",
+					Elem: &schema.Schema{
+						Type:         schema.TypeString,
+						ValidateFunc: validateOvfEnvironmentTransport,
+					},
+				},
+				"product": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					MaxItems:    1,
+					Description: "The product information of the template.",
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"name": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Computed:    true,
+								Description: "The name of the product.",
+							},
+							"vendor": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Computed:    true,
+								Description: "The vendor of the product.",
+							},
+							"version": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Computed:    true,
+								Description: "The short version of the product.",
+							},
+							"full_version": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Computed:    true,
+								Description: "The full version of the product.",
+							},
+							"vendor_url": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Computed:    true,
+								Description: "The URL of the vendor.",
+							},
+							"product_url": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Computed:    true,
+								Description: "The URL of the product.",
+							},
+							"app_url": {
+								Type:        schema.TypeString,
+								Optional:    true,
+								Computed:    true,
+								Description: "The URL of the web interface of the application.",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func validateOvfEnvironmentTransport(v interface{}, k string) ([]string, []error) {
+	if !containsString(ovfEnvironmentTransports, v.(string)) {
+		return nil, []error{fmt.Errorf("%q must be one of %v, got %q", k, ovfEnvironmentTransports, v.(string))}
+	}
+	return nil, nil
+}
+
+// vAppSpec adds the changed vapp block to the config spec, and reports
+// whether it changed anything. Removing the block leaves the vApp options of
+// the virtual machine as they are.
+func vAppSpec(d *schema.ResourceData, props *mo.VirtualMachine, spec *types.VirtualMachineConfigSpec) bool {
+	blocks := d.Get("vapp").([]interface{})
+	if !d.HasChange("vapp") || len(blocks) == 0 || blocks[0] == nil {
+		return false
+	}
+	block := blocks[0].(map[string]interface{})
+
+	current := vAppConfig(props)
+	if !block["enabled"].(bool) {
+		if current == nil {
+			return false
+		}
+		spec.VAppConfigRemoved = types.NewBool(true)
+		return true
+	}
+
+	config := &types.VmConfigSpec{}
+	for _, transport := range block["ovf_environment_transport"].([]interface{}) {
+		config.OvfEnvironmentTransport = append(config.OvfEnvironmentTransport, transport.(string))
+	}
+
+	if products := block["product"].([]interface{}); len(products) > 0 && products[0] != nil {
+		product := products[0].(map[string]interface{})
+		info := &types.VAppProductInfo{
+			Name:        product["name"].(string),
+			Vendor:      product["vendor"].(string),
+			Version:     product["version"].(string),
+			FullVersion: product["full_version"].(string),
+			VendorUrl:   product["vendor_url"].(string),
+			ProductUrl:  product["product_url"].(string),
+			AppUrl:      product["app_url"].(string),
+		}
+		operation := types.ArrayUpdateOperationAdd
+		if current != nil && len(current.Product) > 0 {
+			operation = types.ArrayUpdateOperationEdit
+			info.Key = current.Product[0].Key
+			info.ClassId = current.Product[0].ClassId
+			info.InstanceId = current.Product[0].InstanceId
+		}
+		config.Product = []types.VAppProductSpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: operation},
+			Info:            info,
+		}}
+	}
+
+	spec.VAppConfig = config
+	return true
+}
+
+// readVApp saves the vApp options of the virtual machine to the vapp block,
+// if the block is configured.
+func readVApp(d *schema.ResourceData, props *mo.VirtualMachine) {
+	blocks := d.Get("vapp").([]interface{})
+	if len(blocks) == 0 || blocks[0] == nil {
+		return
+	}
+	block := blocks[0].(map[string]interface{})
+
+	current := vAppConfig(props)
+	block["enabled"] = current != nil
+	if current == nil {
+		d.Set("vapp", []interface{}{block})
+		return
+	}
+
+	block["ovf_environment_transport"] = current.OvfEnvironmentTransport
+	if products := block["product"].([]interface{}); len(products) > 0 && len(current.Product) == 0 {
+		block["product"] = []interface{}{}
+	} else if len(products) > 0 {
+		info := current.Product[0]
+		block["product"] = []interface{}{map[string]interface{}{
+			"name":         info.Name,
+			"vendor":       info.Vendor,
+			"version":      info.Version,
+			"full_version": info.FullVersion,
+			"vendor_url":   info.VendorUrl,
+			"product_url":  info.ProductUrl,
+			"app_url":      info.AppUrl,
+		}}
+	}
+	d.Set("vapp", []interface{}{block})
+}
+
+// vAppConfig returns the vApp options of the virtual machine, or nil if they
+// are disabled.
+func vAppConfig(props *mo.VirtualMachine) *types.VmConfigInfo {
+	if props.Config == nil || props.Config.VAppConfig == nil {
+		return nil
+	}
+	return props.Config.VAppConfig.GetVmConfigInfo()
+}
@@ -2,15 +2,18 @@ package virtualmachine
 
 import (
 	"context"
+	"fmt"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	"log"
 	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
 )
 
-// FromUUID locates a virtualMachine by its UUID.
-func FromUUID(client *govmomi.Client, uuid string) (*object.VirtualMachine, error) {
+// FromUUID locates a virtualMachine by its UUID in the given datacenter, or
+// in all datacenters if dc is nil.
+func FromUUID(client *govmomi.Client, dc *object.Datacenter, uuid string) (*object.VirtualMachine, error) {
 	log.Printf("[DEBUG] Locating virtual machine with UUID %q", uuid)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -20,7 +23,7 @@ func FromUUID(client *govmomi.Client, uuid string) (*object.VirtualMachine, erro
 	var err error
 
 	result, err = object.NewSearchIndex(client.Client).FindByUuid(
-		ctx, nil, uuid, true, nil)
+		ctx, dc, uuid, true, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -57,3 +60,37 @@ func Properties(vm *object.VirtualMachine) (*mo.VirtualMachine, error) {
 	}
 	return &props, nil
 }
+
+// Reconfigure applies the given config spec to the virtual machine and waits
+// for the task to complete, or for ctx to be cancelled.
+func Reconfigure(ctx context.Context, vm *object.VirtualMachine, spec types.VirtualMachineConfigSpec) error {
+	log.Printf("[DEBUG] Reconfiguring VM %q", vm.InventoryPath)
+	task, err := vm.Reconfigure(ctx, spec)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// Usable reports whether the virtual machine can still be used by vSphere. A
+// virtual machine is unusable when vCenter reports it as orphaned,
+// inaccessible or invalid, or when any of its files is inaccessible. The
+// returned string explains why the virtual machine is unusable.
+func Usable(props *mo.VirtualMachine) (bool, string) {
+	switch props.Runtime.ConnectionState {
+	case types.VirtualMachineConnectionStateOrphaned,
+		types.VirtualMachineConnectionStateInaccessible,
+		types.VirtualMachineConnectionStateInvalid:
+		return false, fmt.Sprintf("virtual machine is %s", props.Runtime.ConnectionState)
+	}
+
+	if props.LayoutEx != nil {
+		for _, f := range props.LayoutEx.File {
+			if f.Accessible != nil && !*f.Accessible {
+				return false, fmt.Sprintf("%s file %q is inaccessible", f.Type, f.Name)
+			}
+		}
+	}
+
+	return true, ""
+}